@@ -1,12 +1,18 @@
 package promise
 
 import (
+	"context"
+	"errors"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type element struct {
-	value interface{}
-	next  *element
+	value    interface{}
+	priority int
+	next     *element
 }
 
 type stack struct {
@@ -15,13 +21,34 @@ type stack struct {
 }
 
 func (l *stack) push(x interface{}) *element {
-	e := &element{value: x}
+	return l.pushPriority(x, 0)
+}
+
+// Adds to the stack after every element with the same or a higher priority.
+func (l *stack) pushPriority(x interface{}, priority int) *element {
+	e := &element{value: x, priority: priority}
 	if l.start == nil {
 		l.start = e
-	} else {
+		l.end = e
+		return e
+	}
+	if l.end.priority >= priority {
+		// Fast path for adding to the end.
 		l.end.next = e
+		l.end = e
+		return e
+	}
+	if l.start.priority < priority {
+		e.next = l.start
+		l.start = e
+		return e
+	}
+	prev := l.start
+	for prev.next.priority >= priority {
+		prev = prev.next
 	}
-	l.end = e
+	e.next = prev.next
+	prev.next = e
 	return e
 }
 
@@ -30,6 +57,30 @@ func (l *stack) format() {
 	l.end = nil
 }
 
+// Removes the first element with the value given. The remaining elements are copied rather than relinked so that a
+// snapshot of the start and end which is being walked is not changed.
+func (l *stack) remove(x interface{}) {
+	var start, end *element
+	found := false
+	for e := l.start; e != nil; e = e.next {
+		if !found && e.value == x {
+			found = true
+			continue
+		}
+		c := &element{value: e.value, priority: e.priority}
+		if start == nil {
+			start = c
+		} else {
+			end.next = c
+		}
+		end = c
+	}
+	if found {
+		l.start = start
+		l.end = end
+	}
+}
+
 // Promise is a promise that can be resolved or rejected.
 // Note that manually creating this will result in blank values.
 // You probably want to use .NewRejected, .NewResolved, or .NewFn instead.
@@ -44,6 +95,9 @@ type Promise[T any] struct {
 	// ensures that we do not cause undefined behaviour by making things run in parallel when done
 	doneMu sync.Mutex
 
+	// defines the settling and handler work which still uses the promise after it is done. Recycle waits for this.
+	running sync.WaitGroup
+
 	// Defines the result of the promise.
 	res T
 	err error
@@ -53,15 +107,105 @@ type Promise[T any] struct {
 
 	// defines the error list.
 	errorStack stack
+
+	// defines the channel that is closed when the promise is done. this is made lazily by Done.
+	doneCh chan struct{}
+
+	// defines the name of the promise. this is used for debugging.
+	name string
+
+	// defines the function used to cancel the promise. this is nil if the promise is not cancelable.
+	cancel func()
+
+	// defines the metadata for the promise. this is passed down to promises made by Then and Catch.
+	meta Meta
+
+	// defines the promise this was made from. this is only set when debugging to avoid keeping parents in memory.
+	parent ancestor
+
+	// defines the context for the promise. this is passed down to promises made by Then and Catch.
+	ctx context.Context
+
+	// defines the warnings for the promise. these are passed down to promises made by Then and Catch.
+	warnings []error
+
+	// defines if the result has been observed by a handler or by getting the resolution.
+	observed bool
+}
+
+// Creates a new pending promise.
+func newPending[T any](name string) *Promise[T] {
+	if debugging() {
+		debugf(name, "created")
+	}
+	atomic.AddUint64(&metrics.created, 1)
+	p := acquire[T]()
+	p.notDone = true
+	p.name = name
+	return p
+}
+
+// Creates a new pending promise which inherits from the parent. The parent must be locked.
+func newChild[X any, T any](parent *Promise[T], name string) *Promise[X] {
+	p := newPending[X](name)
+	p.meta = parent.meta
+	p.ctx = parent.ctx
+	if debugging() {
+		p.parent = parent
+	}
+	if !parent.notDone {
+		// The parent is done, so it has all of its warnings.
+		p.warnings = parent.warnings[:len(parent.warnings):len(parent.warnings)]
+	}
+	return p
+}
+
+// Copies the warnings of the parent to the start of the warnings of the child. The parent must be done.
+func inheritWarnings[X any, T any](child *Promise[X], parent *Promise[T]) {
+	parent.lock.Lock()
+	warnings := parent.warnings
+	parent.lock.Unlock()
+	if len(warnings) == 0 {
+		return
+	}
+	child.lock.Lock()
+	child.warnings = append(warnings[:len(warnings):len(warnings)], child.warnings...)
+	child.lock.Unlock()
 }
 
 // Call the function and handle the results.
 func (p *Promise[T]) call(f func() (T, error)) {
+	// Start tracing if there is a tracer.
+	var end func(error)
+	if t := getTracer(); t != nil {
+		end = t(p.name, p.Meta())
+	}
+
 	// Call the function.
-	res, err := f()
+	start := time.Now()
+	var (
+		res T
+		err error
+	)
+	if atomic.LoadInt32(&wrapPanics) == 1 {
+		res, err = recoverCall(f)
+	} else {
+		res, err = f()
+	}
+	if end != nil {
+		end(err)
+	}
+	recordSettle(time.Since(start))
+	if err == nil {
+		atomic.AddUint64(&metrics.resolved, 1)
+	} else {
+		atomic.AddUint64(&metrics.rejected, 1)
+	}
 
 	// Ensures that we do not cause undefined behaviour by making things run in parallel when done
 	p.lock.Lock()
+	p.running.Add(1)
+	defer p.running.Done()
 	p.notDone = false
 	p.err = err
 	p.res = res
@@ -69,18 +213,45 @@ func (p *Promise[T]) call(f func() (T, error)) {
 	errorStack := p.errorStack
 	p.thenStack.format()
 	p.errorStack.format()
+	doneCh := p.doneCh
+	watch := err != nil && !p.observed && getUnhandledRejectionHandler() != nil
 	p.lock.Unlock()
 
+	// Watch for the rejection never being observed.
+	if watch {
+		runtime.SetFinalizer(p, reportUnhandled[T])
+	}
+
+	// Log the result if we are debugging.
+	if debugging() {
+		if err == nil {
+			debugf(p.name, "resolved")
+		} else {
+			debugf(p.name, "rejected: %v", err)
+		}
+	}
+
+	// Close the done channel if something is waiting on it.
+	if doneCh != nil {
+		close(doneCh)
+	}
+
 	// Lock and run handlers.
 	p.doneMu.Lock()
 	defer p.doneMu.Unlock()
 	if err != nil {
 		for s := errorStack.start; s != nil; s = s.next {
+			if debugging() {
+				debugf(p.name, "calling catch handler")
+			}
 			s.value.(func(error))(err)
 		}
 		return
 	}
 	for s := thenStack.start; s != nil; s = s.next {
+		if debugging() {
+			debugf(p.name, "calling then handler")
+		}
 		s.value.(func(T))(res)
 	}
 }
@@ -92,6 +263,19 @@ type PromiseResolution[T any] struct {
 
 	// Error defines if the promise rejected.
 	Error error
+
+	// Warnings defines any non-fatal warnings added to the promise or the promises it was made from.
+	Warnings []error
+}
+
+// PanicValue is used to get the value passed to panic if the promise rejected because of a recovered panic.
+// If the rejection was not caused by a panic, this returns nil and false.
+func (r *PromiseResolution[T]) PanicValue() (interface{}, bool) {
+	var panicErr *PanicError
+	if errors.As(r.Error, &panicErr) {
+		return panicErr.Value, true
+	}
+	return nil, false
 }
 
 // Resolve is used to get the promise resolution. Returns a nil pointer if the promise is unresolved.
@@ -101,37 +285,292 @@ func (p *Promise[T]) Resolve() *PromiseResolution[T] {
 	if p.notDone {
 		return nil
 	}
-	return &PromiseResolution[T]{Result: p.res, Error: p.err}
+	p.observed = true
+	return &PromiseResolution[T]{Result: p.res, Error: p.err, Warnings: p.warnings[:len(p.warnings):len(p.warnings)]}
+}
+
+// Snapshot is used to get a copy of the promise resolution and whether the promise is done. Unlike Resolve,
+// this does not allocate. The resolution will be blank if the promise is unresolved.
+func (p *Promise[T]) Snapshot() (PromiseResolution[T], bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.notDone {
+		return PromiseResolution[T]{}, false
+	}
+	p.observed = true
+	return PromiseResolution[T]{Result: p.res, Error: p.err, Warnings: p.warnings[:len(p.warnings):len(p.warnings)]}, true
+}
+
+// ResolveInto is used to write the result and error of the promise into the pointers given. This returns false and
+// writes nothing if the promise is unresolved. Unlike Resolve, this does not allocate.
+func (p *Promise[T]) ResolveInto(res *T, err *error) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.notDone {
+		return false
+	}
+	p.observed = true
+	*res = p.res
+	*err = p.err
+	return true
+}
+
+// Done is used to get a channel that is closed when the promise resolves or rejects.
+func (p *Promise[T]) Done() <-chan struct{} {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.doneCh == nil {
+		p.doneCh = make(chan struct{})
+		if !p.notDone {
+			// The promise is already done, so close the channel now.
+			close(p.doneCh)
+		}
+	}
+	return p.doneCh
+}
+
+// ResolveContext is used to block until the promise resolves or rejects, or until the context is done.
+// If the context is done first, the context error is returned. This does not affect the promise itself.
+func (p *Promise[T]) ResolveContext(ctx context.Context) (*PromiseResolution[T], error) {
+	// Try the fast path.
+	if res := p.Resolve(); res != nil {
+		return res, nil
+	}
+
+	// Wait for either the promise or the context.
+	select {
+	case <-p.Done():
+		return p.Resolve(), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Defines the default timeout for Await in nanoseconds.
+var defaultTimeout int64
+
+// SetDefaultTimeout is used to set the default timeout for Await. This guards against promises which never
+// resolve blocking forever. If the timeout is 0 or less, Await has no timeout. This is the default.
+func SetDefaultTimeout(d time.Duration) {
+	atomic.StoreInt64(&defaultTimeout, int64(d))
+}
+
+// Await is used to block until the promise resolves or rejects and then return the result and error.
+// If a default timeout was set with SetDefaultTimeout and it is exceeded, ErrTimeout is returned.
+func (p *Promise[T]) Await() (T, error) {
+	return p.AwaitTimeout(time.Duration(atomic.LoadInt64(&defaultTimeout)))
+}
+
+// AwaitTimeout behaves the same as Await but uses the timeout given instead of the default timeout.
+// If the timeout is 0 or less, there is no timeout.
+func (p *Promise[T]) AwaitTimeout(d time.Duration) (T, error) {
+	if d > 0 {
+		// Wait for either the promise or the timeout.
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-p.Done():
+		case <-t.C:
+			atomic.AddUint64(&metrics.timedOut, 1)
+			var zero T
+			return zero, ErrTimeout
+		}
+	}
+	return p.wait()
+}
+
+// Waits for the promise to be done and then returns the result and error. This ignores the default timeout.
+func (p *Promise[T]) wait() (T, error) {
+	<-p.Done()
+	res, _ := p.Snapshot()
+	return res.Result, res.Error
+}
+
+// NotifyAll is used to send the resolution to each of the channels when the promise resolves or rejects.
+// The sends are non-blocking, so if a channel is full (or unbuffered with no receiver waiting), the resolution
+// is dropped for that channel.
+func (p *Promise[T]) NotifyAll(chs ...chan<- PromiseResolution[T]) {
+	// Defines the function to broadcast the resolution.
+	notify := func(res PromiseResolution[T]) {
+		for _, ch := range chs {
+			select {
+			case ch <- res:
+			default:
+			}
+		}
+	}
+
+	// Hook the handler.
+	handle(p, func(res T, err error) (struct{}, error) {
+		notify(PromiseResolution[T]{Result: res, Error: err})
+		return struct{}{}, nil
+	})
 }
 
 // NewFn is used to create a new function promise.
 func NewFn[T any](f func() (T, error)) *Promise[T] {
-	p := &Promise[T]{notDone: true}
+	return NewNamedFn("", f)
+}
+
+// NewNamedFn behaves the same as NewFn but gives the promise a name. The name is used when debugging.
+func NewNamedFn[T any](name string, f func() (T, error)) *Promise[T] {
+	// If the function is nil, reject instead of panicking in the go-routine.
+	if f == nil {
+		return NewRejected[T](ErrNilFunc)
+	}
+
+	p := newPending[T](name)
 	go p.call(f)
 	return p
 }
 
+// Meta is metadata which can be attached to a promise with WithMeta. This is useful for things like request IDs.
+type Meta map[string]interface{}
+
+// WithMeta is used to attach metadata to the promise and returns the promise. The metadata is passed down to
+// promises made from this one with Then and Catch. Note the map is shared, so it should not be changed after this.
+func (p *Promise[T]) WithMeta(m Meta) *Promise[T] {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.meta = m
+	return p
+}
+
+// Meta is used to get the metadata attached to the promise. This is nil if there is no metadata.
+func (p *Promise[T]) Meta() Meta {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.meta
+}
+
+// WithContext is used to attach a context to the promise and returns the promise. The context is passed down to
+// promises made from this one with Then and Catch, so handlers such as ThenHTTP can use its deadline and values.
+// Note this does not cancel the promise when the context is done.
+func (p *Promise[T]) WithContext(ctx context.Context) *Promise[T] {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.ctx = ctx
+	return p
+}
+
+// Context is used to get the context attached to the promise. This is context.Background() if there is no context.
+func (p *Promise[T]) Context() context.Context {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+// AddWarning is used to add a non-fatal warning to the promise. The warnings are given in the resolution and are
+// passed down to promises made from this one with Then and Catch. Warnings added after the promise is done are not
+// passed down to promises which were already made from it. Functions which wait for the promise in their own
+// go-routine instead of adding a handler, such as Timeout, ThenTimeout, and ThenT, do not pass warnings down. To add
+// warnings from inside a handler, use ThenWarn.
+func (p *Promise[T]) AddWarning(err error) {
+	p.lock.Lock()
+	p.warnings = append(p.warnings, err)
+	p.lock.Unlock()
+}
+
+// Defines a promise which can give its ancestry.
+type ancestor interface {
+	Ancestry() []string
+}
+
+// Ancestry is used to get the names of the promises this promise was made from with Then and Catch, from the root
+// to this promise. Promises without a name are shown as "<unnamed>". The links to parent promises are only kept
+// when debugging is on (see SetDebugLogger), so otherwise this only contains the name of this promise.
+func (p *Promise[T]) Ancestry() []string {
+	p.lock.Lock()
+	parent := p.parent
+	name := p.name
+	p.lock.Unlock()
+	if name == "" {
+		name = "<unnamed>"
+	}
+	if parent == nil {
+		return []string{name}
+	}
+	return append(parent.Ancestry(), name)
+}
+
+// Name is used to get the name of the promise. This will be blank if the promise was not named.
+func (p *Promise[T]) Name() string {
+	return p.name
+}
+
 // NewFnWithArg behaves the same as NewFn but allows you to pass in an argument.
 // This is useful for functions that take in an argument or where you want to pass in a context.
 func NewFnWithArg[T any, X any](arg T, f func(T) (X, error)) *Promise[X] {
 	return NewFn(func() (X, error) { return f(arg) })
 }
 
+// NewOnce is used to create a function which returns a promise for a computation which runs at most once. Like
+// NewFn, each promise starts running straight away, so the computation runs the first time the function is called
+// whether or not the promise is waited on. Every promise made by the function settles with the same result. The
+// result is kept with the function, so it is freed along with it.
+func NewOnce[T any](compute func() (T, error)) func() *Promise[T] {
+	var (
+		once sync.Once
+		res  T
+		err  error
+	)
+	return func() *Promise[T] {
+		return NewFn(func() (T, error) {
+			once.Do(func() {
+				res, err = recoverCall(compute)
+			})
+			return res, err
+		})
+	}
+}
+
 // NewResolved is used to create a new resolved promise.
 func NewResolved[T any](result T) *Promise[T] {
+	if debugging() {
+		debugf("", "created resolved")
+	}
+	atomic.AddUint64(&metrics.created, 1)
+	atomic.AddUint64(&metrics.resolved, 1)
 	return &Promise[T]{res: result}
 }
 
 // NewRejected is used to create a new rejected promise.
 func NewRejected[T any](err error) *Promise[T] {
-	return &Promise[T]{err: err}
+	if debugging() {
+		debugf("", "created rejected: %v", err)
+	}
+	atomic.AddUint64(&metrics.created, 1)
+	atomic.AddUint64(&metrics.rejected, 1)
+	p := &Promise[T]{err: err}
+	if err != nil && getUnhandledRejectionHandler() != nil {
+		// Watch for the rejection never being observed.
+		runtime.SetFinalizer(p, reportUnhandled[T])
+	}
+	return p
 }
 
 // Then is used to add a then handler to the promise.
 // In the event that the promise has already resolved, this will result in a new go-routine being spawned.
 func Then[T any, X any](p *Promise[T], f func(T) (X, error)) *Promise[X] {
+	return then(p, "", 0, f)
+}
+
+// ThenPriority behaves the same as Then but the handler has the priority specified. When the promise is done,
+// handlers with a higher priority are called first. Handlers with the same priority are called in the order they
+// were added, and handlers added with Then have a priority of 0. This only affects handlers added before the promise
+// is done, since handlers added after are called straight away.
+func ThenPriority[T any, X any](p *Promise[T], priority int, f func(T) (X, error)) *Promise[X] {
+	return then(p, "", priority, f)
+}
+
+// Adds a then handler to the promise. The new promise has the name and priority specified.
+func then[T any, X any](p *Promise[T], name string, priority int, f func(T) (X, error)) *Promise[X] {
 	// Lock and get all values.
 	p.lock.Lock()
+	p.observed = true
 	done := !p.notDone
 	res := p.res
 	err := p.err
@@ -139,22 +578,24 @@ func Then[T any, X any](p *Promise[T], f func(T) (X, error)) *Promise[X] {
 	// If we are not done, we should add to the handlers.
 	if !done {
 		// Add the then handler.
-		newPromise := &Promise[X]{notDone: true}
+		newPromise := newChild[X](p, name)
 		thenHn := func(res T) {
+			inheritWarnings(newPromise, p)
 			newPromise.call(func() (X, error) {
 				return f(res)
 			})
 		}
-		p.thenStack.push(thenHn)
+		p.thenStack.pushPriority(thenHn, priority)
 
 		// Add the catch handler.
 		catchHn := func(err error) {
+			inheritWarnings(newPromise, p)
 			newPromise.call(func() (_ X, innerErr error) {
 				innerErr = err
 				return
 			})
 		}
-		p.errorStack.push(catchHn)
+		p.errorStack.pushPriority(catchHn, priority)
 
 		// Now unlock the promise.
 		p.lock.Unlock()
@@ -163,11 +604,16 @@ func Then[T any, X any](p *Promise[T], f func(T) (X, error)) *Promise[X] {
 		return newPromise
 	}
 
-	// Unlock the root data.
+	// Create the new promise and unlock the root data.
+	newPromise := newChild[X](p, name)
+	p.running.Add(1)
 	p.lock.Unlock()
 
-	// Create a new promise function to handle this.
-	return NewFn(func() (innerRes X, innerErr error) {
+	// Create a go-routine to handle calling the promise.
+	go newPromise.call(func() (innerRes X, innerErr error) {
+		// Mark the handler as finished once it is done with the parent.
+		defer p.running.Done()
+
 		// Lock the single-thread mutex to prevent undefined behaviour.
 		p.doneMu.Lock()
 
@@ -183,6 +629,9 @@ func Then[T any, X any](p *Promise[T], f func(T) (X, error)) *Promise[X] {
 		// Call the function.
 		return f(res)
 	})
+
+	// Return the promise.
+	return newPromise
 }
 
 // Catch is used to add a error catching handler to the promise.
@@ -190,16 +639,18 @@ func Then[T any, X any](p *Promise[T], f func(T) (X, error)) *Promise[X] {
 func Catch[T any, X any](p *Promise[T], f func(error) (X, error)) *Promise[X] {
 	// Lock and get all values.
 	p.lock.Lock()
+	p.observed = true
 	done := !p.notDone
 	err := p.err
 
 	// Defines the new promise.
-	newPromise := &Promise[X]{notDone: true}
+	newPromise := newChild[X](p, "")
 
 	// If we are not done, we should add to the handlers.
 	if !done {
 		// Add the catch handler.
 		catchHn := func(err error) {
+			inheritWarnings(newPromise, p)
 			newPromise.call(func() (X, error) {
 				return f(err)
 			})
@@ -213,17 +664,23 @@ func Catch[T any, X any](p *Promise[T], f func(error) (X, error)) *Promise[X] {
 		return newPromise
 	}
 
-	// Unlock the root data.
-	p.lock.Unlock()
-
 	// If the error was nil, mark the promise as done and return it.
 	if err == nil {
+		p.lock.Unlock()
 		newPromise.notDone = false
+		atomic.AddUint64(&metrics.resolved, 1)
 		return newPromise
 	}
 
+	// Unlock the root data. The handler is counted first so Recycle can wait for it.
+	p.running.Add(1)
+	p.lock.Unlock()
+
 	// Create a go-routine to handle calling the promise.
 	go newPromise.call(func() (X, error) {
+		// Mark the handler as finished once it is done with the parent.
+		defer p.running.Done()
+
 		// Lock the single-thread mutex to prevent undefined behaviour.
 		p.doneMu.Lock()
 
@@ -237,3 +694,66 @@ func Catch[T any, X any](p *Promise[T], f func(error) (X, error)) *Promise[X] {
 	// Return the promise.
 	return newPromise
 }
+
+// Adds a handler which is called with the result and error when the promise resolves or rejects.
+// In the event that the promise has already resolved, this will result in a new go-routine being spawned.
+func handle[T any, X any](p *Promise[T], f func(T, error) (X, error)) *Promise[X] {
+	// Lock and get all values.
+	p.lock.Lock()
+	p.observed = true
+	done := !p.notDone
+	res := p.res
+	err := p.err
+
+	// If we are not done, we should add to the handlers.
+	if !done {
+		// Add the then and catch handlers.
+		newPromise := newChild[X](p, "")
+		p.thenStack.push(func(res T) {
+			inheritWarnings(newPromise, p)
+			newPromise.call(func() (X, error) {
+				return f(res, nil)
+			})
+		})
+		p.errorStack.push(func(err error) {
+			inheritWarnings(newPromise, p)
+			newPromise.call(func() (X, error) {
+				var zero T
+				return f(zero, err)
+			})
+		})
+
+		// Now unlock the promise.
+		p.lock.Unlock()
+
+		// Return the new promise.
+		return newPromise
+	}
+
+	// Create the new promise and unlock the root data.
+	newPromise := newChild[X](p, "")
+	p.running.Add(1)
+	p.lock.Unlock()
+
+	// Create a go-routine to handle calling the promise.
+	go newPromise.call(func() (X, error) {
+		// Mark the handler as finished once it is done with the parent.
+		defer p.running.Done()
+
+		// Lock the single-thread mutex to prevent undefined behaviour.
+		p.doneMu.Lock()
+
+		// Defer unlocking until this is done.
+		defer p.doneMu.Unlock()
+
+		// Call the function. The result is only given if there was no error.
+		if err != nil {
+			var zero T
+			res = zero
+		}
+		return f(res, err)
+	})
+
+	// Return the promise.
+	return newPromise
+}
@@ -0,0 +1,181 @@
+package promise
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"unicode/utf8"
+)
+
+// CompressResult is used to gzip the bytes the promise resolves with. This is useful for keeping large payloads
+// small in memory or over the wire. If the promise rejects, the error is passed through. See DecompressResult.
+func CompressResult[T ~[]byte](p *Promise[T]) *Promise[[]byte] {
+	return Then(p, func(res T) ([]byte, error) {
+		// Writing to a buffer cannot fail.
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, _ = w.Write(res)
+		_ = w.Close()
+		return buf.Bytes(), nil
+	})
+}
+
+// DecompressResult is used to un-gzip the bytes the promise resolves with, such as ones made by CompressResult. If
+// the bytes are not valid gzip, the new promise rejects with the error. If the promise rejects, the error is passed
+// through.
+func DecompressResult[T ~[]byte](p *Promise[T]) *Promise[[]byte] {
+	return Then(p, func(res T) ([]byte, error) {
+		r, err := gzip.NewReader(bytes.NewReader(res))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	})
+}
+
+// Defines the subset of JSON schema supported by ValidateJSON.
+type jsonSchema struct {
+	Type                 string                 `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+}
+
+// Gets the JSON schema type of a decoded value.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// Validates the decoded value against the schema. The path is used to say where the problem is. A nil schema
+// (such as a property set to null) accepts anything.
+func (s *jsonSchema) validate(path string, v interface{}) error {
+	if s == nil {
+		return nil
+	}
+
+	// Check the type.
+	t := jsonType(v)
+	if s.Type != "" && s.Type != t {
+		f, ok := v.(float64)
+		if s.Type != "integer" || !ok || f != math.Trunc(f) {
+			return fmt.Errorf("%s: expected %s, got %s", path, s.Type, t)
+		}
+	}
+
+	// Check the value is one of the allowed values.
+	if s.Enum != nil {
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value is not one of the allowed values", path)
+		}
+	}
+
+	// Check the type specific keywords.
+	switch x := v.(type) {
+	case float64:
+		if s.Minimum != nil && x < *s.Minimum {
+			return fmt.Errorf("%s: %v is less than the minimum of %v", path, x, *s.Minimum)
+		}
+		if s.Maximum != nil && x > *s.Maximum {
+			return fmt.Errorf("%s: %v is more than the maximum of %v", path, x, *s.Maximum)
+		}
+	case string:
+		n := utf8.RuneCountInString(x)
+		if s.MinLength != nil && n < *s.MinLength {
+			return fmt.Errorf("%s: length %d is less than the minimum of %d", path, n, *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fmt.Errorf("%s: length %d is more than the maximum of %d", path, n, *s.MaxLength)
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range x {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := x[key]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, key)
+			}
+		}
+
+		// Go through the keys in order so the error is the same every time.
+		keys := make([]string, 0, len(x))
+		for key := range x {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			prop, ok := s.Properties[key]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: unexpected property %q", path, key)
+				}
+				continue
+			}
+			if err := prop.validate(path+"."+key, x[key]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateJSON is used to check the JSON the promise resolves with against the schema specified. If it is valid,
+// the bytes are passed through unchanged. If it is not, the new promise rejects with a *ValidationError saying
+// where the problem is. This uses a small built in validator which supports the type, properties, required,
+// additionalProperties, items, enum, minimum, maximum, minLength and maxLength keywords. Other keywords are
+// ignored. If the schema is not valid JSON, the new promise rejects with the error. If the promise rejects, the
+// error is passed through.
+func ValidateJSON[T ~[]byte](p *Promise[T], schema []byte) *Promise[T] {
+	// Parse the schema up front so it is only done once.
+	var s jsonSchema
+	schemaErr := json.Unmarshal(schema, &s)
+
+	return Then(p, func(res T) (T, error) {
+		if schemaErr != nil {
+			return nil, fmt.Errorf("invalid schema: %w", schemaErr)
+		}
+		var v interface{}
+		if err := json.Unmarshal(res, &v); err != nil {
+			return nil, &ValidationError{Err: err}
+		}
+		if err := s.validate("$", v); err != nil {
+			return nil, &ValidationError{Err: err}
+		}
+		return res, nil
+	})
+}
@@ -0,0 +1,131 @@
+package promise
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCompressResult(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		payload := bytes.Repeat([]byte("hello world "), 1000)
+		compressed := CompressResult(NewResolved(payload))
+		b, err := compressed.Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if len(b) >= len(payload) {
+			t.Error("result was not compressed")
+		}
+		res, err := DecompressResult(compressed).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if !bytes.Equal(res, payload) {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("invalid gzip", func(t *testing.T) {
+		_, err := DecompressResult(NewResolved([]byte("hello world"))).Await()
+		if err == nil {
+			t.Error("error is nil")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := CompressResult(NewRejected[[]byte](errors.New("hello world"))).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+		_, err = DecompressResult(NewRejected[[]byte](errors.New("hello world"))).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
+
+func TestValidateJSON(t *testing.T) {
+	schema := []byte(`{
+		"type": "object",
+		"required": ["name", "age"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "maxLength": 10},
+			"age": {"type": "integer", "minimum": 0, "maximum": 150},
+			"score": {"type": "number"},
+			"role": {"enum": ["admin", "user"]},
+			"active": {"type": "boolean"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"list": {"type": "array"},
+			"extra": {},
+			"meta": {"type": "object"}
+		}
+	}`)
+
+	t.Run("valid", func(t *testing.T) {
+		body := []byte(`{"name":"jake","age":25,"score":1.5,"role":"admin","active":true,"tags":["a"],"list":[1],"extra":null,"meta":{"x":1}}`)
+		res, err := ValidateJSON(NewResolved(body), schema).Await()
+		if err != nil {
+			t.Fatal("error is not nil:", err)
+		}
+		if !bytes.Equal(res, body) {
+			t.Error("result is wrong")
+		}
+	})
+
+	for _, tc := range []struct {
+		name string
+		body string
+		msg  string
+	}{
+		{"wrong type", `[]`, "$: expected object, got array"},
+		{"missing required", `{"name":"jake"}`, `$: missing required property "age"`},
+		{"unexpected property", `{"name":"jake","age":25,"other":1}`, `$: unexpected property "other"`},
+		{"not an integer", `{"name":"jake","age":2.5}`, "$.age: expected integer, got number"},
+		{"integer wrong type", `{"name":"jake","age":"25"}`, "$.age: expected integer, got string"},
+		{"under minimum", `{"name":"jake","age":-1}`, "$.age: -1 is less than the minimum of 0"},
+		{"over maximum", `{"name":"jake","age":200}`, "$.age: 200 is more than the maximum of 150"},
+		{"too short", `{"name":"","age":25}`, "$.name: length 0 is less than the minimum of 1"},
+		{"too long", `{"name":"hello world!","age":25}`, "$.name: length 12 is more than the maximum of 10"},
+		{"not in enum", `{"name":"jake","age":25,"role":"guest"}`, "$.role: value is not one of the allowed values"},
+		{"bad item", `{"name":"jake","age":25,"tags":["a",1]}`, "$.tags[1]: expected string, got number"},
+		{"boolean", `{"name":"jake","age":25,"active":"yes"}`, "$.active: expected boolean, got string"},
+		{"malformed", `{"name":`, "unexpected end of JSON input"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ValidateJSON(NewResolved([]byte(tc.body)), schema).Await()
+			if !errors.Is(err, ErrValidation) {
+				t.Fatal("error is not ErrValidation:", err)
+			}
+			if err.Error() != "validation failed: "+tc.msg {
+				t.Error("error message is wrong:", err)
+			}
+		})
+	}
+
+	t.Run("null sub-schema", func(t *testing.T) {
+		body := []byte(`{"x":{"y":1}}`)
+		res, err := ValidateJSON(NewResolved(body), []byte(`{"properties":{"x":null}}`)).Await()
+		if err != nil {
+			t.Fatal("error is not nil:", err)
+		}
+		if !bytes.Equal(res, body) {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("invalid schema", func(t *testing.T) {
+		_, err := ValidateJSON(NewResolved([]byte(`{}`)), []byte(`{`)).Await()
+		if err == nil || errors.Is(err, ErrValidation) {
+			t.Error("error is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := ValidateJSON(NewRejected[[]byte](errors.New("hello world")), schema).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
@@ -0,0 +1,316 @@
+package promise
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Defines a cached promise and when it expires.
+type resultCacheEntry[V any] struct {
+	p       *Promise[V]
+	settled bool
+	expires time.Time
+}
+
+// ResultCache is used to cache the results of functions by key. Successes and failures are kept for different
+// amounts of time, so a failure which might be transient can be retried sooner than a success is refreshed.
+type ResultCache[K comparable, V any] struct {
+	// defines how long successes are kept.
+	posTTL time.Duration
+
+	// defines how long failures are kept.
+	negTTL time.Duration
+
+	// defines the lock for the entries.
+	lock sync.Mutex
+
+	// defines the cached promises by key.
+	entries map[K]*resultCacheEntry[V]
+}
+
+// NewResultCache is used to create a result cache which keeps successes for posTTL and failures for negTTL.
+func NewResultCache[K comparable, V any](posTTL, negTTL time.Duration) *ResultCache[K, V] {
+	return &ResultCache[K, V]{
+		posTTL:  posTTL,
+		negTTL:  negTTL,
+		entries: map[K]*resultCacheEntry[V]{},
+	}
+}
+
+// CacheResult is used to get a function which returns the cached promise for the key. If there is no cached promise
+// or it has expired, the function given is called to make a new one. Calls for a key while its promise is pending
+// share the same promise.
+func (c *ResultCache[K, V]) CacheResult(key K) func(f func() (V, error)) *Promise[V] {
+	return func(f func() (V, error)) *Promise[V] {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		// Check if there is a cached promise which can be used.
+		if e, ok := c.entries[key]; ok && (!e.settled || time.Now().Before(e.expires)) {
+			return e.p
+		}
+
+		// Make a new promise and set when it expires when it is done.
+		e := &resultCacheEntry[V]{p: NewFn(f)}
+		c.entries[key] = e
+		handle(e.p, func(_ V, err error) (struct{}, error) {
+			ttl := c.posTTL
+			if err != nil {
+				ttl = c.negTTL
+			}
+			c.lock.Lock()
+			e.settled = true
+			e.expires = time.Now().Add(ttl)
+			c.lock.Unlock()
+			return struct{}{}, nil
+		})
+		return e.p
+	}
+}
+
+// Defines an entry in a ThenCache.
+type thenCacheEntry[T comparable, X any] struct {
+	in T
+	p  *Promise[X]
+}
+
+// ThenCache is used to keep the results of a stage made with ThenCached by the value the handler was called with.
+// Each stage should have its own cache, since the handler is not part of the key. When there are too many results,
+// the least recently used result is removed.
+type ThenCache[T comparable, X any] struct {
+	// defines the lock for the entries.
+	lock sync.Mutex
+
+	// defines how many results are kept. if this is 0 or less, there is no limit.
+	size int
+
+	// defines the list elements by input.
+	entries map[T]*list.Element
+
+	// defines the entries ordered from the most to the least recently used.
+	order *list.List
+}
+
+// NewThenCache is used to create a cache for ThenCached which keeps up to size results. If size is 0 or less, there
+// is no limit.
+func NewThenCache[T comparable, X any](size int) *ThenCache[T, X] {
+	return &ThenCache[T, X]{
+		size:    size,
+		entries: map[T]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// SetSize is used to set how many results the cache keeps. If n is 0 or less, there is no limit.
+func (c *ThenCache[T, X]) SetSize(n int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.size = n
+	c.evict()
+}
+
+// Clear is used to remove every result kept by the cache.
+func (c *ThenCache[T, X]) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = map[T]*list.Element{}
+	c.order.Init()
+}
+
+// Removes the least recently used results until the cache is within its size. The cache must be locked.
+func (c *ThenCache[T, X]) evict() {
+	for c.size > 0 && c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(*thenCacheEntry[T, X]).in)
+	}
+}
+
+// ThenCached behaves the same as Then but keeps the results of the handler in the cache by the value it is called
+// with. If the handler is called with a value it was already called with, the result is reused instead of calling
+// it again. This includes when the first call is still running. Errors are not kept, so a handler which errors will
+// be called again. The cache should only be used for one stage, since results are kept by value alone.
+func ThenCached[T comparable, X any](c *ThenCache[T, X], p *Promise[T], f func(T) (X, error)) *Promise[X] {
+	return Then(p, func(in T) (X, error) {
+		// Check if there is a result we can use.
+		c.lock.Lock()
+		if e, ok := c.entries[in]; ok {
+			c.order.MoveToFront(e)
+			cached := e.Value.(*thenCacheEntry[T, X]).p
+			c.lock.Unlock()
+			return cached.wait()
+		}
+
+		// Call the handler and keep the promise.
+		cached := NewFnWithArg(in, f)
+		c.entries[in] = c.order.PushFront(&thenCacheEntry[T, X]{in: in, p: cached})
+		c.evict()
+		c.lock.Unlock()
+
+		// If the handler errored, remove the promise so it is called again next time.
+		x, err := cached.wait()
+		if err != nil {
+			c.lock.Lock()
+			if e, ok := c.entries[in]; ok && e.Value.(*thenCacheEntry[T, X]).p == cached {
+				c.order.Remove(e)
+				delete(c.entries, in)
+			}
+			c.lock.Unlock()
+		}
+		return x, err
+	})
+}
+
+// Defines a value in a TTLCache and when it was set.
+type ttlCacheEntry[V any] struct {
+	value V
+	set   time.Time
+}
+
+// TTLCache is used to keep values by key for a time to live. This is safe to use from many go-routines.
+type TTLCache[K comparable, V any] struct {
+	// defines how long values are kept.
+	ttl time.Duration
+
+	// defines the lock for the entries.
+	lock sync.Mutex
+
+	// defines the values by key.
+	entries map[K]ttlCacheEntry[V]
+
+	// defines the keys which are being refreshed by StaleWhileRevalidate.
+	refreshing map[K]struct{}
+}
+
+// NewTTLCache is used to create a cache which keeps values for the ttl. If the ttl is 0 or less, values are kept
+// until they are deleted or replaced.
+func NewTTLCache[K comparable, V any](ttl time.Duration) *TTLCache[K, V] {
+	return &TTLCache[K, V]{
+		ttl:        ttl,
+		entries:    map[K]ttlCacheEntry[V]{},
+		refreshing: map[K]struct{}{},
+	}
+}
+
+// Gets the value and when it was set. Expired values are removed.
+func (c *TTLCache[K, V]) get(key K) (V, time.Time, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e, ok := c.entries[key]
+	if ok && c.ttl > 0 && time.Since(e.set) > c.ttl {
+		delete(c.entries, key)
+		ok = false
+	}
+	return e.value, e.set, ok
+}
+
+// Get is used to get the value for the key. The bool is false if there is no value or it has expired.
+func (c *TTLCache[K, V]) Get(key K) (V, bool) {
+	v, _, ok := c.get(key)
+	return v, ok
+}
+
+// Set is used to set the value for the key. This resets the time to live.
+func (c *TTLCache[K, V]) Set(key K, value V) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[key] = ttlCacheEntry[V]{value: value, set: time.Now()}
+}
+
+// Delete is used to remove the value for the key.
+func (c *TTLCache[K, V]) Delete(key K) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.entries, key)
+}
+
+// Marks the key as refreshing. This returns false if it was already refreshing.
+func (c *TTLCache[K, V]) startRefresh(key K) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.refreshing[key]; ok {
+		return false
+	}
+	c.refreshing[key] = struct{}{}
+	return true
+}
+
+// Marks the key as no longer refreshing.
+func (c *TTLCache[K, V]) endRefresh(key K) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.refreshing, key)
+}
+
+// StaleWhileRevalidate is used to get a value from the cache, calling the function to get it if there is none.
+// If there is a value, the promise resolves with it straight away. If the value is older than staleTTL, the
+// function is also called in the background to refresh the cache, and only one refresh runs for a key at a time.
+// If there is no value, the promise resolves or rejects with the function, and the result is cached if it
+// resolves. Errors from background refreshes are ignored and the old value is kept.
+func StaleWhileRevalidate[T any](cache *TTLCache[string, T], key string, staleTTL time.Duration, f func() (T, error)) *Promise[T] {
+	// Serve the cached value, refreshing it if it is stale.
+	if v, set, ok := cache.get(key); ok {
+		if time.Since(set) > staleTTL && cache.startRefresh(key) {
+			go func() {
+				defer cache.endRefresh(key)
+				if v, err := f(); err == nil {
+					cache.Set(key, v)
+				}
+			}()
+		}
+		return NewResolved(v)
+	}
+
+	// Get the value and cache it.
+	return NewFn(func() (T, error) {
+		v, err := f()
+		if err == nil {
+			cache.Set(key, v)
+		}
+		return v, err
+	})
+}
+
+// Group is used to make sure only one call for a key is running at a time. Calls for a key made whilst one is
+// running share its promise instead of calling the function again. The zero value is ready to use.
+type Group[K comparable, V any] struct {
+	// defines the lock for the calls.
+	lock sync.Mutex
+
+	// defines the running calls by key.
+	calls map[K]*Promise[V]
+}
+
+// Do is used to call the function for the key, unless a call for the key is already running. In that case, the
+// promise of the running call is returned and the function is not called. Once the call is done, the next call for
+// the key calls the function again.
+func (g *Group[K, V]) Do(key K, f func() (V, error)) *Promise[V] {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if p, ok := g.calls[key]; ok {
+		return p
+	}
+	if g.calls == nil {
+		g.calls = map[K]*Promise[V]{}
+	}
+	p := NewFn(func() (V, error) {
+		defer func() {
+			g.lock.Lock()
+			delete(g.calls, key)
+			g.lock.Unlock()
+		}()
+		return f()
+	})
+	g.calls[key] = p
+	return p
+}
+
+// ThenSingleflight behaves the same as Then but shares running handler calls through the group by the value the
+// handler is called with. If promises resolve with the same value whilst the handler is running for it, the
+// handler is only called once and they all get its result.
+func ThenSingleflight[T comparable, X any](g *Group[T, X], p *Promise[T], f func(T) (X, error)) *Promise[X] {
+	return Then(p, func(in T) (X, error) {
+		return g.Do(in, func() (X, error) { return f(in) }).wait()
+	})
+}
@@ -0,0 +1,366 @@
+package promise
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResultCache_CacheResult(t *testing.T) {
+	c := NewResultCache[string, string](time.Millisecond*200, time.Millisecond*20)
+
+	var okCalls, errCalls int32
+	ok := func() (string, error) {
+		atomic.AddInt32(&okCalls, 1)
+		return "hello world", nil
+	}
+	fail := func() (string, error) {
+		atomic.AddInt32(&errCalls, 1)
+		return "", errors.New("hello world")
+	}
+
+	t.Run("pending is shared", func(t *testing.T) {
+		gate := make(chan struct{})
+		var calls int32
+		f := func() (string, error) {
+			atomic.AddInt32(&calls, 1)
+			<-gate
+			return "hello world", nil
+		}
+		a := c.CacheResult("pending")(f)
+		b := c.CacheResult("pending")(f)
+		close(gate)
+		if a != b {
+			t.Error("promise was not shared")
+		}
+		if res, _ := b.Await(); res != "hello world" {
+			t.Error("result is wrong")
+		}
+		if atomic.LoadInt32(&calls) != 1 {
+			t.Error("function was not called once")
+		}
+	})
+
+	t.Run("failed entry expires first", func(t *testing.T) {
+		_, _ = c.CacheResult("ok")(ok).Await()
+		_, _ = c.CacheResult("fail")(fail).Await()
+		time.Sleep(time.Millisecond * 10)
+
+		// Both should still be cached.
+		_, _ = c.CacheResult("ok")(ok).Await()
+		_, _ = c.CacheResult("fail")(fail).Await()
+		if atomic.LoadInt32(&okCalls) != 1 || atomic.LoadInt32(&errCalls) != 1 {
+			t.Fatal("results were not cached")
+		}
+
+		// The failure should have expired but not the success.
+		time.Sleep(time.Millisecond * 30)
+		_, _ = c.CacheResult("ok")(ok).Await()
+		_, err := c.CacheResult("fail")(fail).Await()
+		if err == nil {
+			t.Error("error is nil")
+		}
+		if atomic.LoadInt32(&okCalls) != 1 {
+			t.Error("success was not cached")
+		}
+		if atomic.LoadInt32(&errCalls) != 2 {
+			t.Error("failure was not retried")
+		}
+
+		// Now the success should have expired too.
+		time.Sleep(time.Millisecond * 200)
+		res, _ := c.CacheResult("ok")(ok).Await()
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+		if atomic.LoadInt32(&okCalls) != 2 {
+			t.Error("success was not refreshed")
+		}
+	})
+}
+
+func TestThenCached(t *testing.T) {
+	var calls int32
+	double := func(i int) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		return i * 2, nil
+	}
+
+	t.Run("same input", func(t *testing.T) {
+		c := NewThenCache[int, int](0)
+		atomic.StoreInt32(&calls, 0)
+		a := ThenCached(c, NewResolved(2), double)
+		b := ThenCached(c, NewFn(func() (int, error) { return 2, nil }), double)
+		for _, p := range []*Promise[int]{a, b} {
+			res, err := p.Await()
+			if err != nil {
+				t.Fatal("error is not nil")
+			}
+			if res != 4 {
+				t.Error("result is wrong")
+			}
+		}
+		if atomic.LoadInt32(&calls) != 1 {
+			t.Error("handler was not called once")
+		}
+		_, _ = ThenCached(c, NewResolved(3), double).Await()
+		if atomic.LoadInt32(&calls) != 2 {
+			t.Error("handler was not called for a new input")
+		}
+	})
+
+	t.Run("stages do not share results", func(t *testing.T) {
+		mk := func(factor int) func(int) (int, error) {
+			return func(i int) (int, error) { return i * factor, nil }
+		}
+		tens := NewThenCache[int, int](0)
+		hundreds := NewThenCache[int, int](0)
+		a, _ := ThenCached(tens, NewResolved(2), mk(10)).Await()
+		b, _ := ThenCached(hundreds, NewResolved(2), mk(100)).Await()
+		if a != 20 || b != 200 {
+			t.Error("results are wrong:", a, b)
+		}
+	})
+
+	t.Run("errors are not kept", func(t *testing.T) {
+		c := NewThenCache[int, int](0)
+		var errCalls int32
+		fail := func(i int) (int, error) {
+			atomic.AddInt32(&errCalls, 1)
+			return 0, errors.New("hello world")
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := ThenCached(c, NewResolved(1), fail).Await(); err == nil {
+				t.Error("error is nil")
+			}
+		}
+		if atomic.LoadInt32(&errCalls) != 2 {
+			t.Error("handler was not called again")
+		}
+	})
+
+	t.Run("cleared whilst erroring", func(t *testing.T) {
+		c := NewThenCache[int, int](0)
+		_, err := ThenCached(c, NewResolved(1), func(i int) (int, error) {
+			c.Clear()
+			return 0, errors.New("hello world")
+		}).Await()
+		if err == nil {
+			t.Error("error is nil")
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		c := NewThenCache[int, int](0)
+		atomic.StoreInt32(&calls, 0)
+		_, _ = ThenCached(c, NewResolved(1), double).Await()
+		_, _ = ThenCached(c, NewResolved(2), double).Await()
+		c.SetSize(1)
+		if c.order.Len() != 1 {
+			t.Fatal("cache was not shrunk")
+		}
+
+		// 2 is the most recently used, so 1 should have been removed.
+		_, _ = ThenCached(c, NewResolved(2), double).Await()
+		if atomic.LoadInt32(&calls) != 2 {
+			t.Error("most recently used result was removed")
+		}
+		_, _ = ThenCached(c, NewResolved(1), double).Await()
+		if atomic.LoadInt32(&calls) != 3 {
+			t.Error("least recently used result was kept")
+		}
+	})
+}
+
+func TestTTLCache(t *testing.T) {
+	t.Run("expires", func(t *testing.T) {
+		c := NewTTLCache[string, int](time.Millisecond * 20)
+		c.Set("a", 1)
+		if v, ok := c.Get("a"); !ok || v != 1 {
+			t.Fatal("value was not cached")
+		}
+		time.Sleep(time.Millisecond * 30)
+		if _, ok := c.Get("a"); ok {
+			t.Error("value did not expire")
+		}
+		if len(c.entries) != 0 {
+			t.Error("expired value was not removed")
+		}
+	})
+
+	t.Run("no ttl", func(t *testing.T) {
+		c := NewTTLCache[string, int](0)
+		c.Set("a", 1)
+		time.Sleep(time.Millisecond)
+		if _, ok := c.Get("a"); !ok {
+			t.Error("value expired")
+		}
+		c.Delete("a")
+		if _, ok := c.Get("a"); ok {
+			t.Error("value was not deleted")
+		}
+	})
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	c := NewTTLCache[string, string](0)
+	var calls int32
+	value := "first"
+	gate := make(chan struct{})
+	f := func() (string, error) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			<-gate
+		}
+		return value, nil
+	}
+
+	t.Run("miss", func(t *testing.T) {
+		res, err := StaleWhileRevalidate(c, "key", time.Millisecond*20, f).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "first" {
+			t.Error("result is wrong")
+		}
+		if v, _ := c.Get("key"); v != "first" {
+			t.Error("value was not cached")
+		}
+	})
+
+	t.Run("fresh hit", func(t *testing.T) {
+		res, _ := StaleWhileRevalidate(c, "key", time.Millisecond*20, f).Await()
+		if res != "first" {
+			t.Error("result is wrong")
+		}
+		if atomic.LoadInt32(&calls) != 1 {
+			t.Error("function was called")
+		}
+	})
+
+	t.Run("stale hit", func(t *testing.T) {
+		time.Sleep(time.Millisecond * 30)
+		value = "second"
+
+		// The refresh is blocked, so this must resolve with the stale value straight away.
+		p := StaleWhileRevalidate(c, "key", time.Millisecond*20, f)
+		if res := p.Resolve(); res == nil || res.Result != "first" {
+			t.Fatal("stale value was not served straight away")
+		}
+
+		// Only one refresh should run at a time.
+		_, _ = StaleWhileRevalidate(c, "key", time.Millisecond*20, f).Await()
+		close(gate)
+		for i := 0; i < 100; i++ {
+			if v, _ := c.Get("key"); v == "second" {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if v, _ := c.Get("key"); v != "second" {
+			t.Error("cache was not refreshed")
+		}
+		if atomic.LoadInt32(&calls) != 2 {
+			t.Error("function was not called once to refresh")
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		fail := func() (string, error) {
+			return "", errors.New("hello world")
+		}
+		if _, err := StaleWhileRevalidate(c, "other", time.Millisecond*20, fail).Await(); err == nil {
+			t.Error("error is nil")
+		}
+		if _, ok := c.Get("other"); ok {
+			t.Error("error was cached")
+		}
+
+		// A failed refresh keeps the old value.
+		time.Sleep(time.Millisecond * 30)
+		_, _ = StaleWhileRevalidate(c, "key", time.Millisecond*20, fail).Await()
+		for i := 0; i < 100; i++ {
+			c.lock.Lock()
+			n := len(c.refreshing)
+			c.lock.Unlock()
+			if n == 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if v, _ := c.Get("key"); v != "second" {
+			t.Error("old value was not kept")
+		}
+	})
+}
+
+func TestGroup_Do(t *testing.T) {
+	var g Group[string, int]
+	var calls int32
+	gate := make(chan struct{})
+	f := func() (int, error) {
+		atomic.AddInt32(&calls, 1)
+		<-gate
+		return 1, nil
+	}
+
+	// Calls whilst running share the promise.
+	a := g.Do("key", f)
+	b := g.Do("key", f)
+	if a != b {
+		t.Error("promise was not shared")
+	}
+	close(gate)
+	_, _ = a.Await()
+
+	// Calls after are made again.
+	for i := 0; i < 100; i++ {
+		g.lock.Lock()
+		n := len(g.calls)
+		g.lock.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_, _ = g.Do("key", f).Await()
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Error("function was not called again")
+	}
+}
+
+func TestThenSingleflight(t *testing.T) {
+	var g Group[int, int]
+	var calls int32
+	gate := make(chan struct{})
+	promises := make([]*Promise[int], 10)
+	for i := range promises {
+		promises[i] = ThenSingleflight(&g, NewResolved(5), func(i int) (int, error) {
+			atomic.AddInt32(&calls, 1)
+			<-gate
+			return i * 2, nil
+		})
+	}
+
+	// Wait for every handler to be waiting on the shared call.
+	for i := 0; i < 100; i++ {
+		if atomic.LoadInt32(&calls) != 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(time.Millisecond * 10)
+	close(gate)
+	for _, p := range promises {
+		res, err := p.Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 10 {
+			t.Error("result is wrong")
+		}
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("handler was called %d times", atomic.LoadInt32(&calls))
+	}
+}
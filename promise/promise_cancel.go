@@ -0,0 +1,287 @@
+package promise
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NewCancelableFn behaves the same as NewFn but the function is given a channel that is closed when the
+// promise is cancelled with Cancel. Note the function must cooperate by watching the channel. If the promise
+// is cancelled before the function returns, the promise will reject with ErrCanceled.
+func NewCancelableFn[T any](f func(<-chan struct{}) (T, error)) *Promise[T] {
+	// Defines the cancellation channel.
+	cancelCh := make(chan struct{})
+	var once sync.Once
+
+	// Create the promise.
+	p := newPending[T]("")
+	p.cancel = func() {
+		once.Do(func() { close(cancelCh) })
+	}
+	go p.call(func() (T, error) {
+		// Call the function.
+		res, err := f(cancelCh)
+
+		// If we were cancelled whilst running, reject.
+		select {
+		case <-cancelCh:
+			var zero T
+			return zero, ErrCanceled
+		default:
+			return res, err
+		}
+	})
+	return p
+}
+
+// Cancel is used to cancel the promise. This only does anything for promises made with NewCancelableFn.
+func (p *Promise[T]) Cancel() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+}
+
+// RaceCancel behaves the same as Race but cancels the promises which lost once there is a winner. The returned
+// function cancels every promise and can be called explicitly. Note that only promises made with
+// NewCancelableFn respond to being cancelled. For any other promise, this does nothing.
+func RaceCancel[T any](promises ...*Promise[T]) (T, error, func()) {
+	// Defines the function to cancel all promises.
+	cancel := func() {
+		for _, p := range promises {
+			p.Cancel()
+		}
+	}
+
+	// Race the promises.
+	res, err := Race(promises...)
+
+	// Cancel any promise that is still running.
+	for _, p := range promises {
+		if p.Resolve() == nil {
+			p.Cancel()
+		}
+	}
+	return res, err, cancel
+}
+
+// ThenCancelable behaves the same as Then but also returns a function to cancel the handler.
+// Calling the cancel function closes the channel passed to the handler, so a long-running handler can abort early.
+// Note the handler must cooperate by watching the channel. If the promise is cancelled before the handler
+// finishes, the new promise will reject with ErrCanceled.
+func ThenCancelable[T any, X any](p *Promise[T], f func(T, <-chan struct{}) (X, error)) (*Promise[X], func()) {
+	// Defines the cancellation channel.
+	cancelCh := make(chan struct{})
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() { close(cancelCh) })
+	}
+
+	// Hook the handler.
+	newPromise := Then(p, func(res T) (X, error) {
+		// Call the function.
+		x, err := f(res, cancelCh)
+
+		// If we were cancelled whilst running, reject.
+		select {
+		case <-cancelCh:
+			var zero X
+			return zero, ErrCanceled
+		default:
+			return x, err
+		}
+	})
+
+	// Return the promise and the cancel function.
+	return newPromise, cancel
+}
+
+// ThenUnlessCanceled behaves the same as Then but checks the context right before the handler would be called.
+// If the context is done by then, the new promise rejects with the context error and the handler is not called.
+func ThenUnlessCanceled[T any, X any](ctx context.Context, p *Promise[T], f func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		if err := ctx.Err(); err != nil {
+			var zero X
+			return zero, err
+		}
+		return f(res)
+	})
+}
+
+// Token is used to cancel a tree of promises made with NewFnT and ThenT. Cancelling a token rejects every pending
+// promise made with it, and every promise made with its children, with ErrCanceled.
+type Token struct {
+	// defines the channel which is closed when the token is cancelled.
+	ch chan struct{}
+
+	// ensures the channel is only closed once.
+	once sync.Once
+
+	// defines the lock for the children.
+	lock sync.Mutex
+
+	// defines the tokens which are cancelled with this one.
+	children []*Token
+}
+
+// NewToken is used to create a new token.
+func NewToken() *Token {
+	return &Token{ch: make(chan struct{})}
+}
+
+// Child is used to create a token which is cancelled when this one is. Cancelling the child does not cancel this
+// token. If this token is already cancelled, the child is cancelled straight away.
+func (t *Token) Child() *Token {
+	c := NewToken()
+	t.lock.Lock()
+	select {
+	case <-t.ch:
+		t.lock.Unlock()
+		c.Cancel()
+	default:
+		t.children = append(t.children, c)
+		t.lock.Unlock()
+	}
+	return c
+}
+
+// Cancel is used to cancel the token and all of its children. Calling this more than once does nothing.
+func (t *Token) Cancel() {
+	t.once.Do(func() {
+		close(t.ch)
+		t.lock.Lock()
+		children := t.children
+		t.children = nil
+		t.lock.Unlock()
+		for _, c := range children {
+			c.Cancel()
+		}
+	})
+}
+
+// Done is used to get a channel which is closed when the token is cancelled.
+func (t *Token) Done() <-chan struct{} {
+	return t.ch
+}
+
+// Runs the function unless the token is cancelled before or whilst it runs.
+func callWithToken[T any](t *Token, f func() (T, error)) (T, error) {
+	var zero T
+	select {
+	case <-t.ch:
+		return zero, ErrCanceled
+	default:
+	}
+	res, err := f()
+	select {
+	case <-t.ch:
+		return zero, ErrCanceled
+	default:
+		return res, err
+	}
+}
+
+// NewFnT behaves the same as NewFn but the promise rejects with ErrCanceled if the token is cancelled before or
+// whilst the function runs. The function can watch the token to stop early.
+func NewFnT[T any](t *Token, f func() (T, error)) *Promise[T] {
+	return NewFn(func() (T, error) {
+		return callWithToken(t, f)
+	})
+}
+
+// ThenT behaves the same as Then but the new promise rejects with ErrCanceled as soon as the token is cancelled,
+// even if the promise is still pending. If the handler is running when the token is cancelled, the new promise
+// rejects when it returns. Unlike Then, this uses a go-routine for each promise to watch the token.
+func ThenT[T any, X any](t *Token, p *Promise[T], f func(T) (X, error)) *Promise[X] {
+	p.lock.Lock()
+	newPromise := newChild[X](p, "")
+	p.lock.Unlock()
+	go newPromise.call(func() (X, error) {
+		// Wait for the promise or the token.
+		var zero X
+		select {
+		case <-p.Done():
+		case <-t.ch:
+			return zero, ErrCanceled
+		}
+
+		// Call the handler if the promise resolved.
+		res, err := p.wait()
+		if err != nil {
+			return zero, err
+		}
+		return callWithToken(t, func() (X, error) { return f(res) })
+	})
+	return newPromise
+}
+
+// Defines the grace period for ThenAutoCancel in nanoseconds.
+var autoCancelGracePeriod int64
+
+// SetAutoCancelGracePeriod is used to set how long a result made by ThenAutoCancel has after it resolves before an
+// abandoned resource is cancelled. If the done channel is closed within this time, the cancel function is not
+// called. The default is 0, which means abandoned resources are cancelled as soon as they are found.
+func SetAutoCancelGracePeriod(d time.Duration) {
+	atomic.StoreInt64(&autoCancelGracePeriod, int64(d))
+}
+
+// ThenAutoCancel behaves the same as Then but the handler also returns a done channel and a cancel function for the
+// resource behind the result. If the new promise is garbage collected without its result ever being consumed (by
+// adding a handler or getting the resolution), the cancel function is called so the resource is not leaked. This
+// happens once the grace period (see SetAutoCancelGracePeriod) since the promise resolved has passed, and only if
+// the done channel is not closed by then. If the handler errors, the cancel function is called straight away if
+// it is not nil. Errors from the promise are passed through.
+//
+// This relies on a finalizer, so there are some limitations. An abandoned result is only found once the garbage
+// collector notices the promise is unreachable, which may be well after the grace period or never if the program
+// exits first. The cancel function is called from the finalizer go-routine (or a timer go-routine if the grace
+// period has not passed yet), so it should return quickly. Consuming the result only counts if it happens through
+// the promise, and a promise that is still reachable is never cancelled even if nobody will read it.
+func ThenAutoCancel[T any, X any](p *Promise[T], f func(T) (X, <-chan struct{}, func(), error)) *Promise[X] {
+	// Make sure the new promise is set before the handler uses it.
+	ready := make(chan struct{})
+	var newPromise *Promise[X]
+	newPromise = Then(p, func(res T) (X, error) {
+		<-ready
+		x, done, cancel, err := f(res)
+		if err != nil {
+			if cancel != nil {
+				cancel()
+			}
+			return x, err
+		}
+		if cancel != nil {
+			// The promise resolves, so the unhandled rejection finalizer is never set on it.
+			deadline := time.Now().Add(time.Duration(atomic.LoadInt64(&autoCancelGracePeriod)))
+			runtime.SetFinalizer(newPromise, func(np *Promise[X]) {
+				np.lock.Lock()
+				observed := np.observed
+				np.lock.Unlock()
+				if !observed {
+					autoCancel(time.Until(deadline), done, cancel)
+				}
+			})
+		}
+		return x, nil
+	})
+	close(ready)
+	return newPromise
+}
+
+// Calls cancel after the wait unless the done channel is closed by then.
+func autoCancel(wait time.Duration, done <-chan struct{}, cancel func()) {
+	check := func() {
+		select {
+		case <-done:
+		default:
+			cancel()
+		}
+	}
+	if wait > 0 {
+		time.AfterFunc(wait, check)
+	} else {
+		check()
+	}
+}
@@ -0,0 +1,449 @@
+package promise
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestThenCancelable(t *testing.T) {
+	t.Run("not cancelled", func(t *testing.T) {
+		p, _ := ThenCancelable(NewResolved("hello world"), func(s string, cancel <-chan struct{}) (int, error) {
+			return len(s), nil
+		})
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error != nil {
+			t.Fatal("error is not nil")
+		}
+		if res.Result != 11 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		started := make(chan struct{})
+		p, cancel := ThenCancelable(NewResolved("hello world"), func(s string, cancelCh <-chan struct{}) (int, error) {
+			close(started)
+			select {
+			case <-cancelCh:
+				return 1, nil
+			case <-time.After(time.Second):
+				return 2, nil
+			}
+		})
+		<-started
+		cancel()
+		cancel()
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error != ErrCanceled {
+			t.Error("error is not ErrCanceled")
+		}
+		if res.Result != 0 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("upstream rejected", func(t *testing.T) {
+		var called bool
+		p, _ := ThenCancelable(NewRejected[string](errors.New("hello world")), func(s string, cancel <-chan struct{}) (int, error) {
+			called = true
+			return 0, nil
+		})
+		<-p.Done()
+		if p.Resolve().Error.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+		if called {
+			t.Error("function was called")
+		}
+	})
+}
+
+func TestNewCancelableFn(t *testing.T) {
+	t.Run("not cancelled", func(t *testing.T) {
+		p := NewCancelableFn(func(cancel <-chan struct{}) (string, error) {
+			return "hello world", nil
+		})
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error != nil {
+			t.Fatal("error is not nil")
+		}
+		if res.Result != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		p := NewCancelableFn(func(cancel <-chan struct{}) (string, error) {
+			<-cancel
+			return "hello world", nil
+		})
+		p.Cancel()
+		p.Cancel()
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error != ErrCanceled {
+			t.Error("error is not ErrCanceled")
+		}
+		if res.Result != "" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("not cancelable", func(t *testing.T) {
+		p := NewResolved("hello world")
+		p.Cancel()
+		if p.Resolve().Result != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+}
+
+func TestRaceCancel(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		_, err, cancel := RaceCancel[string]()
+		if err != NoPromises {
+			t.Error("no promises error not thrown")
+		}
+		cancel()
+	})
+
+	t.Run("losers cancelled", func(t *testing.T) {
+		loser := func() *Promise[string] {
+			return NewCancelableFn(func(cancel <-chan struct{}) (string, error) {
+				select {
+				case <-cancel:
+					return "", nil
+				case <-time.After(time.Second):
+					return "too slow", nil
+				}
+			})
+		}
+		a := loser()
+		b := loser()
+		plain := NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 20)
+			return "plain", nil
+		})
+		res, err, cancel := RaceCancel(a, NewResolved("hello world"), b, plain)
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+		for _, p := range []*Promise[string]{a, b} {
+			select {
+			case <-p.Done():
+			case <-time.After(time.Millisecond * 500):
+				t.Fatal("loser was not cancelled")
+			}
+			if p.Resolve().Error != ErrCanceled {
+				t.Error("loser was not cancelled")
+			}
+		}
+		cancel()
+		<-plain.Done()
+		if plain.Resolve().Result != "plain" {
+			t.Error("plain promise was affected")
+		}
+	})
+}
+
+func TestThenUnlessCanceled(t *testing.T) {
+	t.Run("not cancelled", func(t *testing.T) {
+		p := ThenUnlessCanceled(context.Background(), NewResolved("hello world"), func(s string) (int, error) {
+			return len(s), nil
+		})
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error != nil {
+			t.Fatal("error is not nil")
+		}
+		if res.Result != 11 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		p := NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 5)
+			return "hello world", nil
+		})
+		x := ThenUnlessCanceled(ctx, p, func(s string) (int, error) {
+			t.Error("function was called")
+			return 0, nil
+		})
+		cancel()
+		<-x.Done()
+		if x.Resolve().Error != context.Canceled {
+			t.Error("error is not context cancelled")
+		}
+	})
+}
+
+func TestToken(t *testing.T) {
+	t.Run("child", func(t *testing.T) {
+		root := NewToken()
+		child := root.Child()
+		child.Cancel()
+		select {
+		case <-root.Done():
+			t.Error("root was cancelled by the child")
+		default:
+		}
+
+		other := root.Child()
+		root.Cancel()
+		root.Cancel()
+		select {
+		case <-other.Done():
+		default:
+			t.Error("child was not cancelled")
+		}
+
+		select {
+		case <-root.Child().Done():
+		default:
+			t.Error("child of cancelled token was not cancelled")
+		}
+	})
+}
+
+func TestNewFnT(t *testing.T) {
+	t.Run("not cancelled", func(t *testing.T) {
+		res, err := NewFnT(NewToken(), func() (string, error) {
+			return "hello world", nil
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("cancelled before", func(t *testing.T) {
+		tok := NewToken()
+		tok.Cancel()
+		_, err := NewFnT(tok, func() (string, error) {
+			t.Error("function was called")
+			return "", nil
+		}).Await()
+		if err != ErrCanceled {
+			t.Error("error is not ErrCanceled")
+		}
+	})
+
+	t.Run("cancelled whilst running", func(t *testing.T) {
+		tok := NewToken()
+		_, err := NewFnT(tok, func() (string, error) {
+			tok.Cancel()
+			return "hello world", nil
+		}).Await()
+		if err != ErrCanceled {
+			t.Error("error is not ErrCanceled")
+		}
+	})
+}
+
+func TestThenT(t *testing.T) {
+	t.Run("not cancelled", func(t *testing.T) {
+		tok := NewToken()
+		p := ThenT(tok, NewResolved("hello world"), func(s string) (int, error) {
+			return len(s), nil
+		})
+		res, err := p.Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 11 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := ThenT(NewToken(), NewRejected[string](errors.New("hello world")), func(s string) (int, error) {
+			t.Error("handler was called")
+			return 0, nil
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+
+	t.Run("cancelled at root", func(t *testing.T) {
+		root := NewToken()
+		gate := make(chan struct{})
+		defer close(gate)
+		base := NewFn(func() (string, error) {
+			<-gate
+			return "hello world", nil
+		})
+		first := ThenT(root, base, func(s string) (string, error) {
+			t.Error("first handler was called")
+			return s, nil
+		})
+		second := ThenT(root.Child(), first, func(s string) (int, error) {
+			t.Error("second handler was called")
+			return 0, nil
+		})
+		root.Cancel()
+		if _, err := first.AwaitTimeout(time.Second); err != ErrCanceled {
+			t.Error("first level did not reject with ErrCanceled")
+		}
+		if _, err := second.AwaitTimeout(time.Second); err != ErrCanceled {
+			t.Error("second level did not reject with ErrCanceled")
+		}
+	})
+}
+
+func TestAutoCancel(t *testing.T) {
+	t.Run("after wait", func(t *testing.T) {
+		cancelled := make(chan struct{})
+		start := time.Now()
+		autoCancel(time.Millisecond*20, nil, func() { close(cancelled) })
+		select {
+		case <-cancelled:
+			if time.Since(start) < time.Millisecond*20 {
+				t.Error("cancel was called before the wait")
+			}
+		case <-time.After(time.Second):
+			t.Error("cancel was not called")
+		}
+	})
+
+	t.Run("done", func(t *testing.T) {
+		done := make(chan struct{})
+		close(done)
+		autoCancel(0, done, func() { t.Error("cancel was called") })
+	})
+}
+
+func TestThenAutoCancel(t *testing.T) {
+	t.Run("abandoned", func(t *testing.T) {
+		cancelled := make(chan struct{})
+		resolved := make(chan struct{})
+		func() {
+			p := ThenAutoCancel(NewResolved("hello world"), func(s string) (int, <-chan struct{}, func(), error) {
+				defer close(resolved)
+				return len(s), make(chan struct{}), func() { close(cancelled) }, nil
+			})
+			_ = p
+		}()
+		<-resolved
+
+		// Force the garbage collector to run until the result is cancelled.
+		for i := 0; i < 100; i++ {
+			runtime.GC()
+			select {
+			case <-cancelled:
+				return
+			case <-time.After(time.Millisecond * 10):
+			}
+		}
+		t.Error("abandoned result was not cancelled")
+	})
+
+	t.Run("grace period", func(t *testing.T) {
+		// The grace period is far longer than the garbage collection below, so nothing can be cancelled yet.
+		SetAutoCancelGracePeriod(time.Second * 5)
+		defer SetAutoCancelGracePeriod(0)
+		var cancelled int32
+		done := make(chan struct{})
+		func() {
+			p := ThenAutoCancel(NewResolved("hello world"), func(s string) (int, <-chan struct{}, func(), error) {
+				return len(s), done, func() { atomic.AddInt32(&cancelled, 1) }, nil
+			})
+			<-p.Done()
+		}()
+
+		// The result is abandoned, but it should not be cancelled within the grace period.
+		for i := 0; i < 5; i++ {
+			runtime.GC()
+			time.Sleep(time.Millisecond * 5)
+		}
+		if atomic.LoadInt32(&cancelled) != 0 {
+			t.Error("cancel was called within the grace period")
+		}
+
+		// The resource finishes within the grace period, so the check after it does not cancel it.
+		close(done)
+	})
+
+	t.Run("consumed or done", func(t *testing.T) {
+		var cancelled int32
+		cancel := func() { atomic.AddInt32(&cancelled, 1) }
+		func() {
+			// This result is consumed.
+			res, err := ThenAutoCancel(NewResolved("hello world"), func(s string) (int, <-chan struct{}, func(), error) {
+				return len(s), nil, cancel, nil
+			}).Await()
+			if err != nil {
+				t.Fatal("error is not nil")
+			}
+			if res != 11 {
+				t.Error("result is wrong")
+			}
+
+			// This result is abandoned but already done.
+			done := make(chan struct{})
+			close(done)
+			<-ThenAutoCancel(NewResolved("hello world"), func(s string) (int, <-chan struct{}, func(), error) {
+				return len(s), done, cancel, nil
+			}).Done()
+		}()
+		for i := 0; i < 5; i++ {
+			runtime.GC()
+			time.Sleep(time.Millisecond * 10)
+		}
+		if atomic.LoadInt32(&cancelled) != 0 {
+			t.Error("cancel was called")
+		}
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		cancelled := false
+		_, err := ThenAutoCancel(NewResolved("hello world"), func(s string) (int, <-chan struct{}, func(), error) {
+			return 0, nil, func() { cancelled = true }, errors.New("hello world")
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+		if !cancelled {
+			t.Error("cancel was not called")
+		}
+		_, err = ThenAutoCancel(NewResolved("hello world"), func(s string) (int, <-chan struct{}, func(), error) {
+			return 0, nil, nil, errors.New("hello world")
+		}).Await()
+		if err == nil {
+			t.Error("error is nil")
+		}
+	})
+
+	t.Run("no cancel", func(t *testing.T) {
+		res, _ := ThenAutoCancel(NewResolved("hello world"), func(s string) (int, <-chan struct{}, func(), error) {
+			return len(s), nil, nil, nil
+		}).Await()
+		if res != 11 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := ThenAutoCancel(NewRejected[string](errors.New("hello world")), func(s string) (int, <-chan struct{}, func(), error) {
+			t.Error("handler was called")
+			return 0, nil, nil, nil
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
@@ -0,0 +1,19 @@
+//go:build go1.19
+
+package promise
+
+import "sync/atomic"
+
+// ThenCAS is used to store the result of the promise into the atomic pointer when it resolves. The pointer is read
+// when ThenCAS is called, and the result is only stored if the pointer still holds that value when the promise
+// resolves (compare-and-swap). This means if another writer updated the pointer in between, the swap fails and the
+// pointer is left alone. Either way, the result is passed through to the new promise. Errors are passed through and
+// do not touch the pointer.
+func ThenCAS[T any](p *Promise[T], target *atomic.Pointer[T]) *Promise[T] {
+	old := target.Load()
+	return Then(p, func(res T) (T, error) {
+		v := res
+		target.CompareAndSwap(old, &v)
+		return res, nil
+	})
+}
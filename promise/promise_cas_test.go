@@ -0,0 +1,50 @@
+//go:build go1.19
+
+package promise
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestThenCAS(t *testing.T) {
+	t.Run("competing", func(t *testing.T) {
+		// Both promises snapshot the pointer before either resolves.
+		var target atomic.Pointer[string]
+		firstCh := make(chan struct{})
+		secondCh := make(chan struct{})
+		a := ThenCAS(NewFn(func() (string, error) {
+			<-firstCh
+			return "first", nil
+		}), &target)
+		b := ThenCAS(NewFn(func() (string, error) {
+			<-secondCh
+			return "second", nil
+		}), &target)
+
+		// The first to resolve wins the swap.
+		close(firstCh)
+		if res, _ := a.Await(); res != "first" {
+			t.Error("result is wrong")
+		}
+		close(secondCh)
+		if res, _ := b.Await(); res != "second" {
+			t.Error("result was not passed through after a failed swap")
+		}
+		if v := target.Load(); v == nil || *v != "first" {
+			t.Error("pointer was not set by the first promise")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		var target atomic.Pointer[string]
+		_, err := ThenCAS(NewRejected[string](errors.New("hello world")), &target).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+		if target.Load() != nil {
+			t.Error("pointer was changed")
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package promise
+
+import "errors"
+
+// CatchZero is used to turn specific errors into a resolution with the zero value. If the promise rejects with an
+// error that matches one of the targets (using errors.Is), the new promise resolves with the zero value of T.
+// Any other error is passed through, and results are passed through unchanged.
+func CatchZero[T any](p *Promise[T], targets ...error) *Promise[T] {
+	return handle(p, func(res T, err error) (T, error) {
+		if err == nil {
+			return res, nil
+		}
+		for _, target := range targets {
+			if errors.Is(err, target) {
+				var zero T
+				return zero, nil
+			}
+		}
+		return res, err
+	})
+}
+
+// FireAndForget is used when the result of the promise is not needed, but a rejection should not go unnoticed.
+// If the promise rejects, onError is called with the error (for example, to log it). Nothing is returned to wait on.
+func FireAndForget[T any](p *Promise[T], onError func(error)) {
+	Catch(p, func(err error) (struct{}, error) {
+		onError(err)
+		return struct{}{}, nil
+	})
+}
+
+// WithDeadLetter is used to send the resolution of the promise to the dead letter channel if it rejects, so
+// failures can be handled separately (for example, by a retry queue). The new promise still rejects with the
+// error. The send is non-blocking, so if the channel is full (or unbuffered with no receiver waiting), the
+// resolution is dropped. Results are passed through unchanged.
+func WithDeadLetter[T any](p *Promise[T], dlq chan<- PromiseResolution[T]) *Promise[T] {
+	return handle(p, func(res T, err error) (T, error) {
+		if err != nil {
+			select {
+			case dlq <- PromiseResolution[T]{Result: res, Error: err}:
+			default:
+			}
+		}
+		return res, err
+	})
+}
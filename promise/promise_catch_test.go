@@ -0,0 +1,117 @@
+package promise
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCatchZero(t *testing.T) {
+	errNotFound := errors.New("not found")
+	errOther := errors.New("other")
+
+	t.Run("resolved", func(t *testing.T) {
+		p := CatchZero(NewResolved("hello world"), errNotFound)
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error != nil {
+			t.Fatal("error is not nil")
+		}
+		if res.Result != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("matching target", func(t *testing.T) {
+		p := CatchZero(NewRejected[string](fmt.Errorf("wrapped: %w", errNotFound)), errOther, errNotFound)
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error != nil {
+			t.Fatal("error is not nil")
+		}
+		if res.Result != "" {
+			t.Error("result is not the zero value")
+		}
+	})
+
+	t.Run("other error", func(t *testing.T) {
+		p := CatchZero(NewRejected[string](errOther), errNotFound)
+		<-p.Done()
+		if p.Resolve().Error != errOther {
+			t.Error("error was not passed through")
+		}
+	})
+}
+
+func TestFireAndForget(t *testing.T) {
+	t.Run("rejected", func(t *testing.T) {
+		ch := make(chan error, 1)
+		FireAndForget(NewRejected[string](errors.New("hello world")), func(err error) {
+			ch <- err
+		})
+		select {
+		case err := <-ch:
+			if err.Error() != "hello world" {
+				t.Error("error is wrong")
+			}
+		case <-time.After(time.Second):
+			t.Error("onError was not called")
+		}
+	})
+
+	t.Run("resolved", func(t *testing.T) {
+		gate := make(chan struct{})
+		p := NewFn(func() (string, error) {
+			<-gate
+			return "hello world", nil
+		})
+		FireAndForget(p, func(err error) {
+			t.Error("onError was called")
+		})
+		close(gate)
+		_, _ = Then(p, func(s string) (string, error) { return s, nil }).Await()
+	})
+}
+
+func TestWithDeadLetter(t *testing.T) {
+	dlq := make(chan PromiseResolution[string], 1)
+
+	t.Run("resolved", func(t *testing.T) {
+		res, err := WithDeadLetter(NewResolved("hello world"), dlq).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+		if len(dlq) != 0 {
+			t.Error("resolution was sent to the dead letter channel")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		e := errors.New("hello world")
+		_, err := WithDeadLetter(NewRejected[string](e), dlq).Await()
+		if err != e {
+			t.Error("error was not passed through")
+		}
+		select {
+		case r := <-dlq:
+			if r.Error != e {
+				t.Error("dead letter error is wrong")
+			}
+		default:
+			t.Error("resolution was not sent to the dead letter channel")
+		}
+	})
+
+	t.Run("full", func(t *testing.T) {
+		dlq <- PromiseResolution[string]{}
+		defer func() { <-dlq }()
+		_, err := WithDeadLetter(NewRejected[string](errors.New("hello world")), dlq).Await()
+		if err == nil {
+			t.Error("error is nil")
+		}
+	})
+}
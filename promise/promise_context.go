@@ -0,0 +1,17 @@
+//go:build go1.21
+
+package promise
+
+import "context"
+
+// OnContextDone is used to run cleanup when the context is done, unless the promise settles first. This ties the
+// resources behind a promise to the lifetime of a request context. The cleanup is scheduled with context.AfterFunc,
+// so it runs in its own go-routine. If the promise resolves or rejects before the context is done, the cleanup is
+// unscheduled and never runs. The returned promise settles the same as the promise given.
+func OnContextDone[T any](ctx context.Context, p *Promise[T], cleanup func()) *Promise[T] {
+	stop := context.AfterFunc(ctx, cleanup)
+	return handle(p, func(res T, err error) (T, error) {
+		stop()
+		return res, err
+	})
+}
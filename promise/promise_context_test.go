@@ -0,0 +1,52 @@
+//go:build go1.21
+
+package promise
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOnContextDone(t *testing.T) {
+	t.Run("context done first", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cleaned := make(chan struct{})
+		release := make(chan struct{})
+		p := OnContextDone(ctx, NewFn(func() (string, error) {
+			<-release
+			return "hello world", nil
+		}), func() { close(cleaned) })
+		cancel()
+		select {
+		case <-cleaned:
+		case <-time.After(time.Second):
+			t.Fatal("cleanup did not run")
+		}
+		close(release)
+		res, err := p.Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("settled first", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cleaned := make(chan struct{})
+		p := OnContextDone(ctx, NewRejected[string](errors.New("hello world")), func() { close(cleaned) })
+		_, err := p.Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+		cancel()
+		select {
+		case <-cleaned:
+			t.Error("cleanup ran after the promise settled")
+		case <-time.After(time.Millisecond * 20):
+		}
+	})
+}
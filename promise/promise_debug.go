@@ -0,0 +1,154 @@
+package promise
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// Defines the logger used for debugging. This holds a nil logger when debugging is off.
+var debugLogger atomic.Value
+
+// SetDebugLogger is used to turn on logging of promise lifecycle events to the logger specified. This includes
+// promises being created, promises resolving or rejecting, and handlers being called. Passing nil turns
+// debugging off again. This should not be turned on in production.
+func SetDebugLogger(l *log.Logger) {
+	debugLogger.Store(l)
+}
+
+// Gets the debug logger. This returns nil if debugging is off.
+func getDebugLogger() *log.Logger {
+	l, _ := debugLogger.Load().(*log.Logger)
+	return l
+}
+
+// Returns if debugging is on. This should be checked before calling debugf.
+func debugging() bool {
+	return getDebugLogger() != nil
+}
+
+// Tracer is used to trace promise functions. It is called with the name and metadata of the promise when its
+// function starts, and the function it returns is called with the error (if any) when it finishes.
+type Tracer func(name string, meta Meta) (end func(error))
+
+// Defines the tracer in use. This holds a nil Tracer when tracing is off.
+var tracer atomic.Value
+
+// SetTracer is used to set the tracer for promise functions. This allows promises to be traced with any tracing
+// library. Passing nil turns tracing off again.
+func SetTracer(t Tracer) {
+	tracer.Store(t)
+}
+
+// Gets the tracer. This returns nil if tracing is off.
+func getTracer() Tracer {
+	t, _ := tracer.Load().(Tracer)
+	return t
+}
+
+// Span is used to represent a span from any tracing library. End is called with the error (if any) when the stage
+// finishes.
+type Span interface {
+	End(error)
+}
+
+// ThenSpan behaves the same as Then but starts a span with the name specified before the handler is called, and
+// ends it with the error from the handler afterwards. If the handler panics, the span is ended with a *PanicError
+// before the panic carries on. Unlike SetTracer, this is set up explicitly for each stage. If the promise rejects,
+// no span is started.
+func ThenSpan[T any, X any](start func(name string) Span, name string, p *Promise[T], f func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (x X, err error) {
+		span := start(name)
+		defer func() {
+			// If f panicked, end the span with the panic so it is not left open.
+			if r := recover(); r != nil {
+				span.End(&PanicError{Value: r, Stack: debug.Stack()})
+				panic(r)
+			}
+			span.End(err)
+		}()
+		return f(res)
+	})
+}
+
+// Defines the handler for unhandled rejections. This holds a nil function when the handler is not set.
+var unhandledRejectionHandler atomic.Value
+
+// SetUnhandledRejectionHandler is used to set a function which is called when a rejected promise is garbage
+// collected without its error ever being observed. The error is observed by adding a Then or Catch handler, or by
+// getting the resolution (such as with Resolve or Await). Only promises which reject whilst the handler is set are
+// watched. The handler is called from the finalizer go-routine, so it should return quickly. Passing nil turns
+// this off again.
+func SetUnhandledRejectionHandler(f func(error)) {
+	unhandledRejectionHandler.Store(f)
+}
+
+// Gets the handler for unhandled rejections. This returns nil if it is not set.
+func getUnhandledRejectionHandler() func(error) {
+	f, _ := unhandledRejectionHandler.Load().(func(error))
+	return f
+}
+
+// Reports the rejection of a promise which is being garbage collected if it was never observed.
+func reportUnhandled[T any](p *Promise[T]) {
+	f := getUnhandledRejectionHandler()
+	if f == nil {
+		return
+	}
+	p.lock.Lock()
+	observed := p.observed
+	err := p.err
+	p.lock.Unlock()
+	if !observed {
+		f(err)
+	}
+}
+
+// Gets the ID of the current go-routine. This is slow and is only used for debugging.
+func goroutineID() string {
+	buf := make([]byte, 64)
+	buf = bytes.TrimPrefix(buf[:runtime.Stack(buf, false)], []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i != -1 {
+		buf = buf[:i]
+	}
+	return string(buf)
+}
+
+// Logs a debug message for the promise with the name specified.
+func debugf(name, format string, args ...interface{}) {
+	l := getDebugLogger()
+	if l == nil {
+		// Debugging was turned off since it was checked.
+		return
+	}
+	if name == "" {
+		name = "<unnamed>"
+	}
+	args = append([]interface{}{goroutineID(), name}, args...)
+	l.Printf("[goroutine %s] %s: "+format, args...)
+}
+
+// Assert is used to check that the result of the promise holds the invariant given. If it does, the result is passed
+// through unchanged. If it does not, the new promise rejects with ErrAssertion and the message, or if debugging is
+// on, the handler panics so the bug is caught straight away. Errors are passed through.
+func Assert[T any](p *Promise[T], invariant func(T) bool, msg string) *Promise[T] {
+	return Then(p, func(res T) (T, error) {
+		return assertValue(res, invariant, msg)
+	})
+}
+
+// Checks the value against the invariant. This panics if the invariant does not hold and debugging is on.
+func assertValue[T any](res T, invariant func(T) bool, msg string) (T, error) {
+	if invariant(res) {
+		return res, nil
+	}
+	err := fmt.Errorf("%w: %s", ErrAssertion, msg)
+	if debugging() {
+		panic(err)
+	}
+	var zero T
+	return zero, err
+}
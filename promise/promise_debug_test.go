@@ -0,0 +1,401 @@
+package promise
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestDebug(t *testing.T) {
+	// Turn on debugging with our own logger.
+	buf := &lockedBuffer{}
+	SetDebugLogger(log.New(buf, "", 0))
+	defer SetDebugLogger(nil)
+
+	// Run a promise chain.
+	p := NewNamedFn("test", func() (string, error) {
+		return "hello world", nil
+	})
+	if p.Name() != "test" {
+		t.Error("name is wrong")
+	}
+	x := Catch(Then(p, func(s string) (int, error) {
+		return 0, errors.New("hello world")
+	}), func(err error) (int, error) {
+		return 1, nil
+	})
+	<-x.Done()
+	NewResolved("hello world")
+	NewRejected[string](errors.New("hello world"))
+
+	// Check the log output.
+	out := buf.String()
+	for _, s := range []string{
+		"test: created",
+		"test: resolved",
+		"test: calling then handler",
+		"<unnamed>: rejected: hello world",
+		"<unnamed>: calling catch handler",
+		"<unnamed>: created resolved",
+		"<unnamed>: created rejected: hello world",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("log does not contain %q", s)
+		}
+	}
+	if !strings.HasPrefix(out, "[goroutine ") {
+		t.Error("log does not contain the go-routine")
+	}
+
+	// Make sure nothing is logged when debugging is off.
+	SetDebugLogger(nil)
+	debugf("test", "turned off")
+	if strings.Contains(buf.String(), "turned off") {
+		t.Error("logged when debugging is off")
+	}
+}
+
+func TestSetTracer(t *testing.T) {
+	// Set a fake tracer.
+	var (
+		lock   sync.Mutex
+		events []string
+	)
+	SetTracer(func(name string, meta Meta) func(error) {
+		if name != "a" && name != "b" && meta["id"] != 1 {
+			// Ignore promises from other tests.
+			return nil
+		}
+		lock.Lock()
+		events = append(events, fmt.Sprint("start ", name, " ", meta["id"]))
+		lock.Unlock()
+		return func(err error) {
+			lock.Lock()
+			events = append(events, fmt.Sprintf("end %s %v", name, err))
+			lock.Unlock()
+		}
+	})
+	defer SetTracer(nil)
+
+	// Run some promises.
+	p := NewResolved("hello world").WithMeta(Meta{"id": 1})
+	<-Then(p, func(s string) (string, error) {
+		return s, nil
+	}).Done()
+	<-NewNamedFn("a", func() (string, error) {
+		return "hello world", nil
+	}).Done()
+	<-NewNamedFn("b", func() (string, error) {
+		return "", errors.New("hello world")
+	}).Done()
+
+	// Check the events.
+	lock.Lock()
+	defer lock.Unlock()
+	want := []string{"start  1", "end  <nil>", "start a <nil>", "end a <nil>", "start b <nil>", "end b hello world"}
+	if len(events) != len(want) {
+		t.Fatalf("events are wrong: %v", events)
+	}
+	for i, v := range want {
+		if events[i] != v {
+			t.Errorf("event %d is %q", i, events[i])
+		}
+	}
+}
+
+type fakeSpan struct {
+	name  string
+	ended bool
+	err   error
+}
+
+func (s *fakeSpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+func TestThenSpan(t *testing.T) {
+	var spans []*fakeSpan
+	start := func(name string) Span {
+		s := &fakeSpan{name: name}
+		spans = append(spans, s)
+		return s
+	}
+
+	t.Run("resolved", func(t *testing.T) {
+		spans = nil
+		res, err := ThenSpan(start, "parse", NewResolved("hello world"), func(s string) (int, error) {
+			return len(s), nil
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 11 {
+			t.Error("result is wrong")
+		}
+		if len(spans) != 1 || spans[0].name != "parse" || !spans[0].ended || spans[0].err != nil {
+			t.Error("span is wrong")
+		}
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		spans = nil
+		stageErr := errors.New("hello world")
+		_, err := ThenSpan(start, "parse", NewResolved("hello world"), func(s string) (int, error) {
+			return 0, stageErr
+		}).Await()
+		if err != stageErr {
+			t.Error("error was not passed through")
+		}
+		if len(spans) != 1 || !spans[0].ended || spans[0].err != stageErr {
+			t.Error("span was not ended with the error")
+		}
+	})
+
+	t.Run("handler panic", func(t *testing.T) {
+		SetWrapPanics(true)
+		defer SetWrapPanics(false)
+		spans = nil
+		_, err := ThenSpan(start, "parse", NewResolved("hello world"), func(s string) (int, error) {
+			panic(s)
+		}).Await()
+		var panicErr *PanicError
+		if !errors.As(err, &panicErr) || panicErr.Value != "hello world" {
+			t.Error("panic was not passed through")
+		}
+		if len(spans) != 1 || !spans[0].ended {
+			t.Fatal("span was not ended")
+		}
+		if !errors.As(spans[0].err, &panicErr) || panicErr.Value != "hello world" {
+			t.Error("span was not ended with the panic")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		spans = nil
+		_, err := ThenSpan(start, "parse", NewRejected[string](errors.New("hello world")), func(s string) (int, error) {
+			t.Error("handler was called")
+			return 0, nil
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+		if len(spans) != 0 {
+			t.Error("span was started")
+		}
+	})
+}
+
+func TestAssert(t *testing.T) {
+	positive := func(i int) bool { return i > 0 }
+
+	t.Run("satisfied", func(t *testing.T) {
+		res, err := Assert(NewResolved(1), positive, "value must be positive").Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 1 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("violated", func(t *testing.T) {
+		_, err := Assert(NewResolved(-1), positive, "value must be positive").Await()
+		if !errors.Is(err, ErrAssertion) {
+			t.Fatal("error is not ErrAssertion")
+		}
+		if err.Error() != "assertion failed: value must be positive" {
+			t.Error("error message is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := Assert(NewRejected[int](errors.New("hello world")), positive, "value must be positive").Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+
+	t.Run("violated while debugging", func(t *testing.T) {
+		SetDebugLogger(log.New(&lockedBuffer{}, "", 0))
+		defer SetDebugLogger(nil)
+		defer func() {
+			err, _ := recover().(error)
+			if !errors.Is(err, ErrAssertion) {
+				t.Error("did not panic with ErrAssertion")
+			}
+		}()
+		_, _ = assertValue(-1, positive, "value must be positive")
+	})
+}
+
+func TestSetUnhandledRejectionHandler(t *testing.T) {
+	// Report the errors we are looking for.
+	errUnhandled := errors.New("unhandled")
+	errFnUnhandled := errors.New("function unhandled")
+	errHandled := errors.New("handled")
+	ch := make(chan error, 3)
+	SetUnhandledRejectionHandler(func(err error) {
+		if err == errUnhandled || err == errFnUnhandled || err == errHandled {
+			ch <- err
+		}
+	})
+	defer SetUnhandledRejectionHandler(nil)
+
+	// Create the promises and drop them.
+	func() {
+		_ = NewRejected[string](errUnhandled)
+		p := NewFn(func() (string, error) {
+			return "", errFnUnhandled
+		})
+		<-p.Done()
+		_ = NewRejected[string](errHandled).Resolve()
+		_ = NewResolved("hello world")
+	}()
+
+	// Force the garbage collector to run until both unhandled rejections are reported.
+	seen := map[error]bool{}
+	for i := 0; i < 100 && len(seen) < 2; i++ {
+		runtime.GC()
+		select {
+		case err := <-ch:
+			seen[err] = true
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	if !seen[errUnhandled] {
+		t.Error("rejected promise was not reported")
+	}
+	if !seen[errFnUnhandled] {
+		t.Error("rejected function promise was not reported")
+	}
+	if seen[errHandled] {
+		t.Error("handled rejection was reported")
+	}
+}
+
+func TestSetUnhandledRejectionHandler_Combinators(t *testing.T) {
+	// Report the error if it is seen at all.
+	errBoom := errors.New("boom")
+	ch := make(chan error, 100)
+	SetUnhandledRejectionHandler(func(err error) {
+		if err == errBoom {
+			ch <- err
+		}
+	})
+	defer SetUnhandledRejectionHandler(nil)
+
+	// Run the combinators over rejecting promises and handle the errors they return.
+	func() {
+		rejecting := func() *Promise[string] {
+			return NewFn(func() (string, error) {
+				time.Sleep(time.Millisecond)
+				return "", errBoom
+			})
+		}
+		if _, err := All(rejecting()); err != errBoom {
+			t.Error("All did not return the error")
+		}
+		if _, err := Race(rejecting()); err != errBoom {
+			t.Error("Race did not return the error")
+		}
+		if _, _, err := Iterator(rejecting())(); err != errBoom {
+			t.Error("Iterator did not return the error")
+		}
+		if _, err := AllProgress(func(int, int) {}, rejecting()); err != errBoom {
+			t.Error("AllProgress did not return the error")
+		}
+		_, _ = OrderTracker(rejecting()).Await()
+		ntfy := make(chan PromiseResolution[string], 1)
+		rejecting().NotifyAll(ntfy)
+		<-ntfy
+	}()
+
+	// Force the garbage collector to run and make sure nothing is reported.
+	for i := 0; i < 5; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond * 10)
+	}
+	select {
+	case <-ch:
+		t.Error("handled rejection was reported")
+	default:
+	}
+}
+
+func TestReportUnhandled(t *testing.T) {
+	p := NewRejected[string](errors.New("hello world"))
+
+	t.Run("no handler", func(t *testing.T) {
+		// This should do nothing.
+		reportUnhandled(p)
+	})
+
+	t.Run("observed", func(t *testing.T) {
+		SetUnhandledRejectionHandler(func(error) {
+			t.Error("handler was called")
+		})
+		defer SetUnhandledRejectionHandler(nil)
+		_ = p.Resolve()
+		reportUnhandled(p)
+	})
+}
+
+func TestPromise_Ancestry(t *testing.T) {
+	t.Run("debugging", func(t *testing.T) {
+		SetDebugLogger(log.New(&lockedBuffer{}, "", 0))
+		defer SetDebugLogger(nil)
+		p := NewNamedFn("fetch", func() (string, error) {
+			return "hello world", nil
+		})
+		parsed := ThenNamed(p, "parse", func(s string) (int, error) {
+			return len(s), nil
+		})
+		stored := ThenNamed(parsed, "store", func(i int) (int, error) {
+			return i, nil
+		})
+		caught := Catch(stored, func(error) (int, error) {
+			return 0, nil
+		})
+		if a := strings.Join(stored.Ancestry(), " > "); a != "fetch > parse > store" {
+			t.Error("ancestry is wrong:", a)
+		}
+		if a := strings.Join(caught.Ancestry(), " > "); a != "fetch > parse > store > <unnamed>" {
+			t.Error("ancestry is wrong:", a)
+		}
+	})
+
+	t.Run("not debugging", func(t *testing.T) {
+		p := ThenNamed(NewNamedFn("fetch", func() (string, error) {
+			return "hello world", nil
+		}), "parse", func(s string) (int, error) {
+			return len(s), nil
+		})
+		if a := strings.Join(p.Ancestry(), " > "); a != "parse" {
+			t.Error("ancestry is wrong:", a)
+		}
+	})
+}
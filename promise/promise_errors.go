@@ -0,0 +1,179 @@
+package promise
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+)
+
+// NoPromises is used for Race where it is expected that promises will be set.
+var NoPromises = errors.New("no promises specified")
+
+// ErrTimeout is used when a promise did not resolve or reject in time.
+var ErrTimeout = errors.New("promise timed out")
+
+// ErrCanceled is used when a promise was cancelled before it could finish.
+var ErrCanceled = errors.New("promise canceled")
+
+// ErrNilFunc is used when a nil function is given where a function is required.
+var ErrNilFunc = errors.New("function is nil")
+
+// ErrTypeMismatch is used when a value is not of the type that was expected.
+var ErrTypeMismatch = errors.New("type mismatch")
+
+// ErrPending is used when a promise has not resolved or rejected yet.
+var ErrPending = errors.New("promise is pending")
+
+// ErrReleased is used when a promise was used after it was released.
+var ErrReleased = errors.New("promise was released")
+
+// ErrAlreadyConsumed is used when a result that can only be consumed once was consumed again.
+var ErrAlreadyConsumed = errors.New("promise was already consumed")
+
+// ErrCompleted is used when an observable completed before it emitted a value.
+var ErrCompleted = errors.New("observable completed")
+
+// ErrAssertion is used when a value did not hold an invariant given to Assert.
+var ErrAssertion = errors.New("assertion failed")
+
+// ErrCircuitOpen is used when a breaker is open and the function was not called.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrTooLarge is used when a result is over the size limit given to LimitSize.
+var ErrTooLarge = errors.New("result is too large")
+
+// ErrBulkheadFull is used when a bulkhead is running and queueing as many handlers as it can.
+var ErrBulkheadFull = errors.New("bulkhead is full")
+
+// ErrBudgetExceeded is used when a latency budget was used up before a stage could run.
+var ErrBudgetExceeded = errors.New("latency budget exceeded")
+
+// ErrValidation is used when a value failed validation in Coerce. Errors from Coerce are *ValidationError, which
+// matches this with errors.Is.
+var ErrValidation = errors.New("validation failed")
+
+// ValidationError is used when a value failed validation in Coerce or ValidateJSON. It matches ErrValidation with
+// errors.Is, and unwraps to the error describing why.
+type ValidationError struct {
+	// Err is the error returned by the coercion function, or the problem found by ValidateJSON.
+	Err error
+}
+
+// Error is used to return the validation error as a string.
+func (e *ValidationError) Error() string {
+	return ErrValidation.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap is used to return the error describing why validation failed.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Is is used to make the error match ErrValidation.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// PanicError is used when a panic was recovered and turned into an error.
+type PanicError struct {
+	// Value is the value that was passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the go-routine when it panicked.
+	Stack []byte
+}
+
+// Error is used to return the panic value as a string.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("promise panicked: %v", e.Value)
+}
+
+// Calls the function and turns any panic into a *PanicError.
+func recoverCall[T any](f func() (T, error)) (res T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&metrics.panics, 1)
+			var zero T
+			res = zero
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return f()
+}
+
+// Defines if panics in promise functions and handlers are turned into rejections. This is 1 when it is on.
+var wrapPanics int32
+
+// SetWrapPanics is used to turn on recovering panics in every promise function and handler. When this is on, a
+// panic rejects the promise with a *PanicError holding the panic value and stack instead of crashing the program.
+// This is off by default, so panics are not hidden unless the application opts in.
+func SetWrapPanics(wrap bool) {
+	var v int32
+	if wrap {
+		v = 1
+	}
+	atomic.StoreInt32(&wrapPanics, v)
+}
+
+// Defines an error with a compacted message which still unwraps to the original error.
+type compactError struct {
+	msg string
+	err error
+}
+
+// Error is used to return the compacted message.
+func (e *compactError) Error() string {
+	return e.msg
+}
+
+// Unwrap is used to return the original error.
+func (e *compactError) Unwrap() error {
+	return e.err
+}
+
+// CompactError is used to remove adjacent duplicate messages from a chain of wrapped errors. For example, an error
+// with the message "fetch: fetch: fetch: timeout" becomes "fetch: timeout". The error returned still unwraps to the
+// original error, so errors.Is and errors.As work the same. If there is nothing to remove, the error is returned as is.
+func CompactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// Split the message into the part each error in the chain adds.
+	var segments []string
+	msg := err.Error()
+	for e := errors.Unwrap(err); e != nil; e = errors.Unwrap(e) {
+		next := e.Error()
+		if !strings.HasSuffix(msg, next) {
+			// The message does not end with the wrapped message, so we cannot split it.
+			break
+		}
+		segments = append(segments, msg[:len(msg)-len(next)])
+		msg = next
+	}
+	segments = append(segments, msg)
+
+	// Rebuild the message without the adjacent duplicates.
+	var b strings.Builder
+	changed := false
+	for i, s := range segments {
+		if i != 0 && s == segments[i-1] {
+			changed = true
+			continue
+		}
+		b.WriteString(s)
+	}
+	if !changed {
+		return err
+	}
+	return &compactError{msg: b.String(), err: err}
+}
+
+// CompactErrors is used to create a promise which passes through the result but runs any error through CompactError.
+func CompactErrors[T any](p *Promise[T]) *Promise[T] {
+	return handle(p, func(res T, err error) (T, error) {
+		return res, CompactError(err)
+	})
+}
@@ -0,0 +1,181 @@
+package promise
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	errs := []error{
+		NoPromises,
+		ErrTimeout,
+		ErrCanceled,
+		ErrNilFunc,
+		ErrTypeMismatch,
+		ErrPending,
+		ErrReleased,
+		ErrAlreadyConsumed,
+		ErrCompleted,
+		ErrAssertion,
+		ErrCircuitOpen,
+		ErrTooLarge,
+		ErrValidation,
+		ErrBulkheadFull,
+		ErrBudgetExceeded,
+	}
+	for i, a := range errs {
+		for j, b := range errs {
+			if i != j && (errors.Is(a, b) || a.Error() == b.Error()) {
+				t.Errorf("%q is not distinct from %q", a, b)
+			}
+		}
+	}
+}
+
+func TestRecoverCall(t *testing.T) {
+	t.Run("no panic", func(t *testing.T) {
+		res, err := recoverCall(func() (string, error) {
+			return "hello world", nil
+		})
+		if err != nil {
+			t.Error("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		res, err := recoverCall(func() (string, error) {
+			panic("hello world")
+		})
+		var panicErr *PanicError
+		if !errors.As(err, &panicErr) {
+			t.Fatal("error is not a panic error")
+		}
+		if panicErr.Value != "hello world" {
+			t.Error("panic value is wrong")
+		}
+		if err.Error() != "promise panicked: hello world" {
+			t.Error("message is wrong")
+		}
+		if !strings.Contains(string(panicErr.Stack), "TestRecoverCall") {
+			t.Error("stack is wrong")
+		}
+		if res != "" {
+			t.Error("result is wrong")
+		}
+	})
+}
+
+func TestSetWrapPanics(t *testing.T) {
+	SetWrapPanics(true)
+	defer SetWrapPanics(false)
+
+	t.Run("function", func(t *testing.T) {
+		_, err := NewFn(func() (string, error) {
+			panic("hello world")
+		}).Await()
+		var panicErr *PanicError
+		if !errors.As(err, &panicErr) {
+			t.Fatal("error is not a panic error")
+		}
+		if panicErr.Value != "hello world" {
+			t.Error("panic value is wrong")
+		}
+		if len(panicErr.Stack) == 0 {
+			t.Error("stack is empty")
+		}
+	})
+
+	t.Run("handler", func(t *testing.T) {
+		_, err := Then(NewResolved("hello world"), func(s string) (int, error) {
+			panic(s)
+		}).Await()
+		var panicErr *PanicError
+		if !errors.As(err, &panicErr) {
+			t.Fatal("error is not a panic error")
+		}
+	})
+
+	t.Run("no panic", func(t *testing.T) {
+		res, err := NewFn(func() (string, error) {
+			return "hello world", nil
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+}
+
+type customWrapError struct {
+	err error
+}
+
+func (e customWrapError) Error() string { return "custom" }
+
+func (e customWrapError) Unwrap() error { return e.err }
+
+func TestCompactError(t *testing.T) {
+	base := errors.New("timeout")
+
+	t.Run("nil", func(t *testing.T) {
+		if CompactError(nil) != nil {
+			t.Error("error is not nil")
+		}
+	})
+
+	t.Run("deeply wrapped", func(t *testing.T) {
+		err := base
+		for i := 0; i < 10; i++ {
+			err = fmt.Errorf("fetch: %w", err)
+		}
+		err = fmt.Errorf("load user: %w", err)
+		compacted := CompactError(err)
+		if compacted.Error() != "load user: fetch: timeout" {
+			t.Errorf("message is wrong: %q", compacted.Error())
+		}
+		if !errors.Is(compacted, base) {
+			t.Error("error does not unwrap to the original")
+		}
+	})
+
+	t.Run("no duplicates", func(t *testing.T) {
+		err := fmt.Errorf("fetch: %w", base)
+		if CompactError(err) != err {
+			t.Error("error was changed")
+		}
+	})
+
+	t.Run("message cannot be split", func(t *testing.T) {
+		err := customWrapError{err: fmt.Errorf("fetch: %w", base)}
+		if CompactError(err) != error(err) {
+			t.Error("error was changed")
+		}
+	})
+}
+
+func TestCompactErrors(t *testing.T) {
+	t.Run("resolved", func(t *testing.T) {
+		res, err := CompactErrors(NewResolved("hello world")).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		err := fmt.Errorf("a: %w", fmt.Errorf("a: %w", errors.New("b")))
+		_, err = CompactErrors(NewRejected[string](err)).Await()
+		if err == nil || err.Error() != "a: b" {
+			t.Error("error was not compacted")
+		}
+	})
+}
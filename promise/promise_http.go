@@ -0,0 +1,36 @@
+package promise
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// ThenHTTP behaves the same as Then but the handler is given the context of the promise (see WithContext) to make
+// an HTTP request with. This means deadlines and tracing values set on the promise reach the request. If the
+// promise rejects, the handler is not called and the error is passed through.
+func ThenHTTP[T any](p *Promise[T], f func(context.Context, T) (*http.Response, error)) *Promise[*http.Response] {
+	return Then(p, func(res T) (*http.Response, error) {
+		return f(p.Context(), res)
+	})
+}
+
+// ThenDecodeJSON is used to decode JSON from the reader extracted from the result of the promise, such as the body
+// of an HTTP response. The new promise resolves with the decoded value, or rejects with the error if decoding
+// fails. If the reader is also an io.Closer, it is closed once decoding is done. If the promise rejects, extract is
+// not called.
+func ThenDecodeJSON[T any, X any](p *Promise[T], extract func(T) io.Reader) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		r := extract(res)
+		if c, ok := r.(io.Closer); ok {
+			defer c.Close()
+		}
+		var x X
+		if err := json.NewDecoder(r).Decode(&x); err != nil {
+			var zero X
+			return zero, err
+		}
+		return x, nil
+	})
+}
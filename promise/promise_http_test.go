@@ -0,0 +1,105 @@
+package promise
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThenHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	t.Run("success", func(t *testing.T) {
+		deadline := time.Now().Add(time.Minute)
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		p := NewResolved(srv.URL).WithContext(ctx)
+		resp, err := ThenHTTP(p, func(ctx context.Context, url string) (*http.Response, error) {
+			if d, ok := ctx.Deadline(); !ok || !d.Equal(deadline) {
+				t.Error("context deadline is wrong")
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			return http.DefaultClient.Do(req)
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil:", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Error("status code is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := ThenHTTP(NewRejected[string](errors.New("hello world")), func(context.Context, string) (*http.Response, error) {
+			t.Error("handler was called")
+			return nil, nil
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
+
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestThenDecodeJSON(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	t.Run("success", func(t *testing.T) {
+		body := &closeTracker{Reader: strings.NewReader(`{"name":"jake","age":25}`)}
+		res, err := ThenDecodeJSON[*closeTracker, user](NewResolved(body), func(c *closeTracker) io.Reader {
+			return c
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil:", err)
+		}
+		if res != (user{Name: "jake", Age: 25}) {
+			t.Error("result is wrong")
+		}
+		if !body.closed {
+			t.Error("reader was not closed")
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := ThenDecodeJSON[string, user](NewResolved(`{"name":`), func(s string) io.Reader {
+			return strings.NewReader(s)
+		}).Await()
+		if err == nil {
+			t.Error("error is nil")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := ThenDecodeJSON[string, user](NewRejected[string](errors.New("hello world")), func(s string) io.Reader {
+			t.Error("extract was called")
+			return nil
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
@@ -0,0 +1,321 @@
+package promise
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Semaphore is used to limit how many functions can run at once. A semaphore is safe to share across the whole
+// program, unlike limits which are scoped to a single batch of promises.
+type Semaphore struct {
+	slots chan struct{}
+}
+
+// NewSemaphore is used to create a semaphore which allows n functions to run at once. If n is less than 1, only
+// 1 function will be allowed to run at once.
+func NewSemaphore(n int) *Semaphore {
+	if n < 1 {
+		n = 1
+	}
+	return &Semaphore{slots: make(chan struct{}, n)}
+}
+
+// NewFnWithSemaphore behaves the same as NewFn but waits for a slot in the semaphore before calling the function.
+// The slot is released when the function returns. The wait happens in the promise go-routine, so this does not block.
+func NewFnWithSemaphore[T any](s *Semaphore, f func() (T, error)) *Promise[T] {
+	return NewFn(func() (T, error) {
+		s.slots <- struct{}{}
+		defer func() { <-s.slots }()
+		return f()
+	})
+}
+
+// RateLimiter is used to limit how often functions can start. Unlike Semaphore, this bounds the throughput
+// rather than how many functions are running at once.
+type RateLimiter struct {
+	// defines the time between each token.
+	interval time.Duration
+
+	// defines the lock for the next token.
+	lock sync.Mutex
+
+	// defines when the next token is available.
+	next time.Time
+}
+
+// NewRateLimiter is used to create a rate limiter which allows the number of functions specified to start each
+// second. If perSecond is 0 or less, there is no limit.
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	var interval time.Duration
+	if perSecond > 0 {
+		interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return &RateLimiter{interval: interval}
+}
+
+// Reserves the next token and returns how long to wait until it is available.
+func (r *RateLimiter) reserve() time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	wait := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	return wait
+}
+
+// Takes the next token if it is available now. This returns false without waiting if it is not.
+func (r *RateLimiter) tryReserve() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := time.Now()
+	if r.next.After(now) {
+		return false
+	}
+	r.next = now.Add(r.interval)
+	return true
+}
+
+// NewFnWithRateLimiter behaves the same as NewFn but waits for a token from the rate limiter before calling the
+// function. The wait happens in the promise go-routine, so this does not block.
+func NewFnWithRateLimiter[T any](r *RateLimiter, f func() (T, error)) *Promise[T] {
+	return NewFn(func() (T, error) {
+		time.Sleep(r.reserve())
+		return f()
+	})
+}
+
+// TapRateLimited is used to call the side effect with the result of the promise, but only if a token is available
+// from the rate limiter straight away. If there is not, the side effect is skipped. The result and any error are
+// always passed through unchanged and without waiting, so this is useful for sampling logs or metrics.
+func TapRateLimited[T any](p *Promise[T], limiter *RateLimiter, f func(T)) *Promise[T] {
+	return Then(p, func(res T) (T, error) {
+		if limiter.tryReserve() {
+			f(res)
+		}
+		return res, nil
+	})
+}
+
+// Breaker is used to stop calling a function which keeps failing. After the threshold of failures in a row, the
+// breaker opens and rejects straight away for the cooldown. After the cooldown, a single trial call is allowed
+// through. If it succeeds the breaker closes, and if it fails the breaker opens again.
+type Breaker struct {
+	// defines the number of failures in a row before the breaker opens.
+	threshold int
+
+	// defines how long the breaker stays open.
+	cooldown time.Duration
+
+	// defines the lock for the state below.
+	lock sync.Mutex
+
+	// defines the number of failures in a row.
+	failures int
+
+	// defines when the breaker allows a trial call.
+	openUntil time.Time
+
+	// defines if a trial call is running.
+	trial bool
+}
+
+// NewBreaker is used to create a breaker which opens after the threshold of failures in a row and stays open for
+// the cooldown. If threshold is less than 1, the breaker opens after 1 failure.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Returns if a call is allowed through the breaker.
+func (b *Breaker) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.trial || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// Records the result of a call which was allowed through the breaker.
+func (b *Breaker) record(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.trial = false
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// ThenBreaker behaves the same as Then but runs the function through the breaker. If the breaker is open, the new
+// promise rejects with ErrCircuitOpen without calling the function. Errors from the promise are passed through and
+// do not count as failures.
+func ThenBreaker[T any, X any](b *Breaker, p *Promise[T], f func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		if !b.allow() {
+			var zero X
+			return zero, ErrCircuitOpen
+		}
+		x, err := f(res)
+		b.record(err)
+		return x, err
+	})
+}
+
+// Defines the lock for a key and how many are using it.
+type keyedMutexEntry struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// KeyedMutex is used to make sure functions for the same key do not run at the same time. Functions for different
+// keys can still run at the same time. The zero value is ready to use.
+type KeyedMutex struct {
+	// defines the lock for the entries.
+	lock sync.Mutex
+
+	// defines the locks by key. entries are removed when nothing is using them.
+	entries map[string]*keyedMutexEntry
+}
+
+// Lock is used to lock the key. This blocks until the key is unlocked.
+func (m *KeyedMutex) Lock(key string) {
+	m.lock.Lock()
+	if m.entries == nil {
+		m.entries = map[string]*keyedMutexEntry{}
+	}
+	e, ok := m.entries[key]
+	if !ok {
+		e = &keyedMutexEntry{}
+		m.entries[key] = e
+	}
+	e.refs++
+	m.lock.Unlock()
+	e.mu.Lock()
+}
+
+// Unlock is used to unlock the key. This panics if the key is not locked.
+func (m *KeyedMutex) Unlock(key string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		panic("promise: unlock of unlocked key " + key)
+	}
+	e.refs--
+	if e.refs == 0 {
+		delete(m.entries, key)
+	}
+	e.mu.Unlock()
+}
+
+// ThenLocked behaves the same as Then but the handler holds the lock for the key whilst it runs. This makes sure
+// handlers using the same key never run at the same time, which is useful for state that is shared per key.
+func ThenLocked[T any, X any](km *KeyedMutex, key string, p *Promise[T], f func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		km.Lock(key)
+		defer km.Unlock(key)
+		return f(res)
+	})
+}
+
+// Bulkhead is used to isolate a resource by limiting how many handlers can use it at once and how many can wait.
+// Unlike Semaphore, handlers which cannot wait are rejected straight away instead of waiting forever.
+type Bulkhead struct {
+	// defines the slots for running handlers.
+	running chan struct{}
+
+	// defines the slots for running and queued handlers.
+	admitted chan struct{}
+}
+
+// NewBulkhead is used to create a bulkhead which runs up to maxConcurrent handlers at once and queues up to
+// maxQueue more. If maxConcurrent is less than 1, only 1 handler will run at once. If maxQueue is less than 0,
+// nothing is queued.
+func NewBulkhead(maxConcurrent, maxQueue int) *Bulkhead {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	return &Bulkhead{
+		running:  make(chan struct{}, maxConcurrent),
+		admitted: make(chan struct{}, maxConcurrent+maxQueue),
+	}
+}
+
+// ThenBulkhead behaves the same as Then but runs the handler in the bulkhead. If the bulkhead is running as many
+// handlers as it can and the queue is full, the new promise rejects with ErrBulkheadFull without calling the
+// handler. Errors from the promise are passed through.
+func ThenBulkhead[T any, X any](b *Bulkhead, p *Promise[T], f func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		// Try to get into the queue.
+		select {
+		case b.admitted <- struct{}{}:
+		default:
+			var zero X
+			return zero, ErrBulkheadFull
+		}
+		defer func() { <-b.admitted }()
+
+		// Wait for a slot to run in.
+		b.running <- struct{}{}
+		defer func() { <-b.running }()
+		return f(res)
+	})
+}
+
+// Budget is used to share a latency budget between the stages of a pipeline. Each stage made with ThenBudget uses
+// up the time its handler takes, and once the budget is used up, later stages reject straight away.
+type Budget struct {
+	// defines how much of the budget has been used in nanoseconds. this is first so it is 64-bit aligned for atomic
+	// operations.
+	used int64
+
+	// defines the total budget.
+	total time.Duration
+}
+
+// NewBudget is used to create a budget with the total time specified.
+func NewBudget(total time.Duration) *Budget {
+	return &Budget{total: total}
+}
+
+// Remaining is used to get how much of the budget is left. This is 0 if the budget is used up.
+func (b *Budget) Remaining() time.Duration {
+	if r := b.total - time.Duration(atomic.LoadInt64(&b.used)); r > 0 {
+		return r
+	}
+	return 0
+}
+
+// ThenBudget behaves the same as Then but the time the handler takes is used from the budget. If the budget is
+// already used up when the promise resolves, the new promise rejects with ErrBudgetExceeded without calling the
+// handler. Note a handler which starts within the budget is not stopped if it goes over. Errors from the promise
+// are passed through.
+func ThenBudget[T any, X any](b *Budget, p *Promise[T], f func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		if b.Remaining() == 0 {
+			var zero X
+			return zero, ErrBudgetExceeded
+		}
+		start := time.Now()
+		defer func() { atomic.AddInt64(&b.used, int64(time.Since(start))) }()
+		return f(res)
+	})
+}
@@ -0,0 +1,403 @@
+package promise
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewSemaphore(t *testing.T) {
+	if cap(NewSemaphore(0).slots) != 1 {
+		t.Error("semaphore size is wrong")
+	}
+	if cap(NewSemaphore(5).slots) != 5 {
+		t.Error("semaphore size is wrong")
+	}
+}
+
+func TestNewFnWithSemaphore(t *testing.T) {
+	s := NewSemaphore(2)
+	var running, max int32
+	promises := make([]*Promise[int], 10)
+	for i := range promises {
+		x := i
+		promises[i] = NewFnWithSemaphore(s, func() (int, error) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond * 2)
+			atomic.AddInt32(&running, -1)
+			return x, nil
+		})
+	}
+	res, err := All(promises...)
+	if err != nil {
+		t.Fatal("error is not nil")
+	}
+	for i, v := range res {
+		if v != i {
+			t.Error("result is wrong")
+		}
+	}
+	if m := atomic.LoadInt32(&max); m != 2 {
+		t.Errorf("max concurrency was %d", m)
+	}
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	if NewRateLimiter(0).interval != 0 {
+		t.Error("interval is wrong")
+	}
+	if NewRateLimiter(4).interval != time.Millisecond*250 {
+		t.Error("interval is wrong")
+	}
+}
+
+func TestNewFnWithRateLimiter(t *testing.T) {
+	r := NewRateLimiter(100)
+	start := time.Now()
+	promises := make([]*Promise[int], 5)
+	for i := range promises {
+		x := i
+		promises[i] = NewFnWithRateLimiter(r, func() (int, error) {
+			return x, nil
+		})
+	}
+	res, err := All(promises...)
+	if err != nil {
+		t.Fatal("error is not nil")
+	}
+	for i, v := range res {
+		if v != i {
+			t.Error("result is wrong")
+		}
+	}
+	if d := time.Since(start); d < time.Millisecond*40 {
+		t.Errorf("calls took %s", d)
+	}
+}
+
+func TestTapRateLimited(t *testing.T) {
+	t.Run("limited", func(t *testing.T) {
+		r := NewRateLimiter(10)
+		var calls int32
+		promises := make([]*Promise[int], 50)
+		for i := range promises {
+			promises[i] = TapRateLimited(NewResolved(i), r, func(int) {
+				atomic.AddInt32(&calls, 1)
+			})
+		}
+		res, err := All(promises...)
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		for i, v := range res {
+			if v != i {
+				t.Error("result is wrong")
+			}
+		}
+
+		// The tokens are 100ms apart, so at most 2 calls can have been made.
+		if c := atomic.LoadInt32(&calls); c < 1 || c > 2 {
+			t.Errorf("side effect was called %d times", c)
+		}
+	})
+
+	t.Run("no limit", func(t *testing.T) {
+		r := NewRateLimiter(0)
+		var calls int32
+		for i := 0; i < 5; i++ {
+			_, _ = TapRateLimited(NewResolved(i), r, func(int) {
+				atomic.AddInt32(&calls, 1)
+			}).Await()
+		}
+		if atomic.LoadInt32(&calls) != 5 {
+			t.Error("side effect was not called every time")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := TapRateLimited(NewRejected[int](errors.New("hello world")), NewRateLimiter(0), func(int) {
+			t.Error("side effect was called")
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
+
+func TestNewBreaker(t *testing.T) {
+	if NewBreaker(0, time.Second).threshold != 1 {
+		t.Error("threshold is wrong")
+	}
+	if NewBreaker(5, time.Second).threshold != 5 {
+		t.Error("threshold is wrong")
+	}
+}
+
+func TestThenBreaker(t *testing.T) {
+	var calls int32
+	fail := true
+	f := func(s string) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		if fail {
+			return "", errors.New("hello world")
+		}
+		return s, nil
+	}
+	b := NewBreaker(2, time.Millisecond*50)
+
+	t.Run("upstream rejected", func(t *testing.T) {
+		_, err := ThenBreaker(b, NewRejected[string](ErrTimeout), f).Await()
+		if err != ErrTimeout {
+			t.Error("error was not passed through")
+		}
+		if atomic.LoadInt32(&calls) != 0 {
+			t.Error("function was called")
+		}
+	})
+
+	t.Run("trips open", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			_, err := ThenBreaker(b, NewResolved("hello world"), f).Await()
+			if err == nil || err.Error() != "hello world" {
+				t.Error("error is wrong")
+			}
+		}
+		if atomic.LoadInt32(&calls) != 2 {
+			t.Error("function was not called twice")
+		}
+	})
+
+	t.Run("stays open during cooldown", func(t *testing.T) {
+		_, err := ThenBreaker(b, NewResolved("hello world"), f).Await()
+		if err != ErrCircuitOpen {
+			t.Error("error is not ErrCircuitOpen")
+		}
+		if atomic.LoadInt32(&calls) != 2 {
+			t.Error("function was called")
+		}
+	})
+
+	t.Run("failed trial opens again", func(t *testing.T) {
+		time.Sleep(time.Millisecond * 60)
+		_, err := ThenBreaker(b, NewResolved("hello world"), f).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+		_, err = ThenBreaker(b, NewResolved("hello world"), f).Await()
+		if err != ErrCircuitOpen {
+			t.Error("error is not ErrCircuitOpen")
+		}
+	})
+
+	t.Run("only one trial at a time", func(t *testing.T) {
+		time.Sleep(time.Millisecond * 60)
+		if !b.allow() {
+			t.Fatal("trial was not allowed")
+		}
+		if b.allow() {
+			t.Error("second trial was allowed")
+		}
+		b.record(errors.New("hello world"))
+	})
+
+	t.Run("closes after successful trial", func(t *testing.T) {
+		time.Sleep(time.Millisecond * 60)
+		fail = false
+		for i := 0; i < 3; i++ {
+			res, err := ThenBreaker(b, NewResolved("hello world"), f).Await()
+			if err != nil {
+				t.Fatal("error is not nil")
+			}
+			if res != "hello world" {
+				t.Error("result is wrong")
+			}
+		}
+	})
+}
+
+func TestKeyedMutex(t *testing.T) {
+	t.Run("unlock of unlocked key", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("did not panic")
+			}
+		}()
+		var m KeyedMutex
+		m.Unlock("hello")
+	})
+
+	t.Run("entries are removed", func(t *testing.T) {
+		var m KeyedMutex
+		m.Lock("hello")
+		m.Lock("world")
+		m.Unlock("hello")
+		m.Unlock("world")
+		if len(m.entries) != 0 {
+			t.Error("entries were not removed")
+		}
+	})
+}
+
+func TestThenLocked(t *testing.T) {
+	var km KeyedMutex
+	var running, overlaps int32
+	f := func(i int) (int, error) {
+		if atomic.AddInt32(&running, 1) != 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		time.Sleep(time.Millisecond * 5)
+		atomic.AddInt32(&running, -1)
+		return i, nil
+	}
+
+	// Build two chains which share a key.
+	chain := func(start int) *Promise[int] {
+		p := NewResolved(start)
+		for i := 0; i < 5; i++ {
+			p = ThenLocked(&km, "entity", p, f)
+		}
+		return p
+	}
+	a, b := chain(1), chain(2)
+	if res, err := a.Await(); err != nil || res != 1 {
+		t.Error("first chain result is wrong")
+	}
+	if res, err := b.Await(); err != nil || res != 2 {
+		t.Error("second chain result is wrong")
+	}
+	if atomic.LoadInt32(&overlaps) != 0 {
+		t.Error("handlers overlapped")
+	}
+
+	// Make sure different keys can run at the same time.
+	gate := make(chan struct{})
+	other := ThenLocked(&km, "other", NewResolved(0), func(i int) (int, error) {
+		<-gate
+		return i, nil
+	})
+	_, _ = ThenLocked(&km, "entity", NewResolved(0), func(i int) (int, error) {
+		close(gate)
+		return i, nil
+	}).Await()
+	_, _ = other.Await()
+}
+
+func TestNewBulkhead(t *testing.T) {
+	b := NewBulkhead(0, -1)
+	if cap(b.running) != 1 || cap(b.admitted) != 1 {
+		t.Error("bulkhead size is wrong")
+	}
+	b = NewBulkhead(2, 3)
+	if cap(b.running) != 2 || cap(b.admitted) != 5 {
+		t.Error("bulkhead size is wrong")
+	}
+}
+
+func TestThenBulkhead(t *testing.T) {
+	t.Run("under limit", func(t *testing.T) {
+		b := NewBulkhead(2, 0)
+		res, err := ThenBulkhead(b, NewResolved("hello world"), func(s string) (int, error) {
+			return len(s), nil
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 11 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("queues and rejects when full", func(t *testing.T) {
+		b := NewBulkhead(1, 1)
+		gate := make(chan struct{})
+		started := make(chan struct{}, 2)
+		var running, max int32
+		f := func(i int) (int, error) {
+			n := atomic.AddInt32(&running, 1)
+			if n > atomic.LoadInt32(&max) {
+				atomic.StoreInt32(&max, n)
+			}
+			started <- struct{}{}
+			<-gate
+			atomic.AddInt32(&running, -1)
+			return i, nil
+		}
+
+		// Fill the running slot and then the queue.
+		first := ThenBulkhead(b, NewResolved(1), f)
+		<-started
+		queued := ThenBulkhead(b, NewResolved(2), f)
+		for len(b.admitted) != 2 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// The next one should be rejected.
+		_, err := ThenBulkhead(b, NewResolved(3), f).Await()
+		if err != ErrBulkheadFull {
+			t.Error("error is not ErrBulkheadFull")
+		}
+
+		// Let the rest finish.
+		close(gate)
+		if res, err := first.Await(); err != nil || res != 1 {
+			t.Error("first result is wrong")
+		}
+		if res, err := queued.Await(); err != nil || res != 2 {
+			t.Error("queued result is wrong")
+		}
+		if atomic.LoadInt32(&max) != 1 {
+			t.Error("handlers ran at the same time")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := ThenBulkhead(NewBulkhead(1, 0), NewRejected[int](ErrTimeout), func(i int) (int, error) {
+			t.Error("handler was called")
+			return i, nil
+		}).Await()
+		if err != ErrTimeout {
+			t.Error("error was not passed through")
+		}
+	})
+}
+
+func TestThenBudget(t *testing.T) {
+	b := NewBudget(time.Millisecond * 20)
+	var calls int32
+	slow := func(i int) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Millisecond * 15)
+		return i + 1, nil
+	}
+
+	// The first two stages use up the budget, so the third is skipped.
+	p := ThenBudget(b, NewResolved(0), slow)
+	p = ThenBudget(b, p, slow)
+	p = ThenBudget(b, p, slow)
+	_, err := p.Await()
+	if err != ErrBudgetExceeded {
+		t.Error("error is not ErrBudgetExceeded")
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Error("handler was not called twice")
+	}
+	if b.Remaining() != 0 {
+		t.Error("budget is not used up")
+	}
+
+	// Errors from the promise are passed through.
+	_, err = ThenBudget(NewBudget(time.Second), NewRejected[int](ErrTimeout), slow).Await()
+	if err != ErrTimeout {
+		t.Error("error was not passed through")
+	}
+	if r := NewBudget(time.Second).Remaining(); r != time.Second {
+		t.Error("remaining budget is wrong")
+	}
+}
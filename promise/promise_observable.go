@@ -0,0 +1,203 @@
+package promise
+
+import (
+	"sync"
+	"time"
+)
+
+// Defines a subscriber to an observable.
+type subscriber[T any] struct {
+	onNext     func(T)
+	onError    func(error)
+	onComplete func()
+}
+
+// Observable is a promise-like value which can emit many values over time until it errors or completes.
+// The zero value is ready to use. Subscribers only get values emitted after they subscribed. Handlers are called
+// one at a time and must not call Next, Error, or Complete on the same observable.
+type Observable[T any] struct {
+	// defines the lock for the subscribers and state.
+	lock sync.Mutex
+
+	// ensures that subscribers are not called in parallel.
+	emitMu sync.Mutex
+
+	// defines the subscriber list.
+	subscribers stack
+
+	// defines if the observable is done, and the error if it errored.
+	done bool
+	err  error
+}
+
+// Gets a snapshot of the subscribers. Returns false if the observable is done.
+func (o *Observable[T]) snapshot() (start, end *element, ok bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.subscribers.start, o.subscribers.end, !o.done
+}
+
+// Calls the function for each subscriber in the list.
+func eachSubscriber[T any](start, end *element, f func(*subscriber[T])) {
+	if start == nil {
+		return
+	}
+	for s := start; ; s = s.next {
+		f(s.value.(*subscriber[T]))
+		if s == end {
+			return
+		}
+	}
+}
+
+// Next is used to emit a value to all subscribers. This does nothing if the observable is done.
+func (o *Observable[T]) Next(value T) {
+	o.emitMu.Lock()
+	defer o.emitMu.Unlock()
+	start, end, ok := o.snapshot()
+	if !ok {
+		return
+	}
+	eachSubscriber(start, end, func(s *subscriber[T]) {
+		if s.onNext != nil {
+			s.onNext(value)
+		}
+	})
+}
+
+// Marks the observable as done and returns the subscribers. Returns false if it was already done.
+func (o *Observable[T]) finish(err error) (start, end *element, ok bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.done {
+		return nil, nil, false
+	}
+	o.done = true
+	o.err = err
+	start, end = o.subscribers.start, o.subscribers.end
+	o.subscribers.format()
+	return start, end, true
+}
+
+// Error is used to emit an error to all subscribers and mark the observable as done.
+// This does nothing if the observable is already done.
+func (o *Observable[T]) Error(err error) {
+	o.emitMu.Lock()
+	defer o.emitMu.Unlock()
+	start, end, ok := o.finish(err)
+	if !ok {
+		return
+	}
+	eachSubscriber(start, end, func(s *subscriber[T]) {
+		if s.onError != nil {
+			s.onError(err)
+		}
+	})
+}
+
+// Complete is used to mark the observable as done without an error.
+// This does nothing if the observable is already done.
+func (o *Observable[T]) Complete() {
+	o.emitMu.Lock()
+	defer o.emitMu.Unlock()
+	start, end, ok := o.finish(nil)
+	if !ok {
+		return
+	}
+	eachSubscriber(start, end, func(s *subscriber[T]) {
+		if s.onComplete != nil {
+			s.onComplete()
+		}
+	})
+}
+
+// Adds a subscriber. If the observable is already done, the subscriber is told straight away.
+func (o *Observable[T]) subscribe(s *subscriber[T]) {
+	o.lock.Lock()
+	if !o.done {
+		o.subscribers.push(s)
+		o.lock.Unlock()
+		return
+	}
+	err := o.err
+	o.lock.Unlock()
+
+	// The observable is already done.
+	if err != nil {
+		if s.onError != nil {
+			s.onError(err)
+		}
+	} else if s.onComplete != nil {
+		s.onComplete()
+	}
+}
+
+// Removes a subscriber so it is not called again.
+func (o *Observable[T]) unsubscribe(s *subscriber[T]) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.subscribers.remove(s)
+}
+
+// Subscribe is used to add handlers for values and errors emitted after this is called. Either handler can be nil.
+// If the observable already errored, onError is called straight away.
+func (o *Observable[T]) Subscribe(onNext func(T), onError func(error)) {
+	o.subscribe(&subscriber[T]{onNext: onNext, onError: onError})
+}
+
+// ToPromise is used to create a promise which resolves with the next value emitted. If the observable errors first,
+// the promise rejects with the error. If the observable completes first, the promise rejects with ErrCompleted.
+func (o *Observable[T]) ToPromise() *Promise[T] {
+	// Subscribe and send the first outcome to the channel. The subscriber removes itself once it has an outcome.
+	ch := make(chan PromiseResolution[T], 1)
+	var s *subscriber[T]
+	send := func(res PromiseResolution[T]) {
+		select {
+		case ch <- res:
+			o.unsubscribe(s)
+		default:
+		}
+	}
+	s = &subscriber[T]{
+		onNext:     func(v T) { send(PromiseResolution[T]{Result: v}) },
+		onError:    func(err error) { send(PromiseResolution[T]{Error: err}) },
+		onComplete: func() { send(PromiseResolution[T]{Error: ErrCompleted}) },
+	}
+	o.subscribe(s)
+
+	// Wait for the outcome in a promise.
+	return NewFn(func() (T, error) {
+		res := <-ch
+		return res.Result, res.Error
+	})
+}
+
+// ThenDebounced is used to call f with the latest value emitted by the observable once it has stopped emitting for
+// the duration specified. If many values are emitted within the window, f is only called once with the last of
+// them. Like other subscribers, this only sees values emitted after it was called. f is called in its own
+// go-routine.
+func ThenDebounced[T any](o *Observable[T], d time.Duration, f func(T)) {
+	var (
+		lock   sync.Mutex
+		latest T
+		gen    uint64
+	)
+	o.Subscribe(func(v T) {
+		lock.Lock()
+		defer lock.Unlock()
+		latest = v
+		gen++
+		g := gen
+		time.AfterFunc(d, func() {
+			// Do nothing if a value was emitted since this timer was started.
+			lock.Lock()
+			if gen != g {
+				lock.Unlock()
+				return
+			}
+			v := latest
+			lock.Unlock()
+			f(v)
+		})
+	}, nil)
+}
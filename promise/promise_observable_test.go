@@ -0,0 +1,156 @@
+package promise
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestObservable(t *testing.T) {
+	t.Run("multiple emissions", func(t *testing.T) {
+		o := &Observable[int]{}
+		a := []int{}
+		b := []int{}
+		o.Subscribe(func(i int) { a = append(a, i) }, nil)
+		o.Subscribe(func(i int) { b = append(b, i) }, func(error) {})
+		o.Next(1)
+		o.Next(2)
+		o.Next(3)
+		o.Complete()
+		o.Complete()
+		o.Next(4)
+		if len(a) != 3 || a[0] != 1 || a[1] != 2 || a[2] != 3 {
+			t.Error("values are wrong")
+		}
+		if len(b) != 3 {
+			t.Error("values are wrong")
+		}
+	})
+
+	t.Run("error termination", func(t *testing.T) {
+		o := &Observable[int]{}
+		a := []int{}
+		var gotErr error
+		o.Subscribe(func(i int) { a = append(a, i) }, func(err error) { gotErr = err })
+		o.Subscribe(nil, nil)
+		o.Next(1)
+		o.Error(errors.New("hello world"))
+		o.Error(errors.New("second"))
+		o.Next(2)
+		if len(a) != 1 || a[0] != 1 {
+			t.Error("values are wrong")
+		}
+		if gotErr == nil || gotErr.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+
+		// Late subscribers are told about the error.
+		var lateErr error
+		o.Subscribe(nil, func(err error) { lateErr = err })
+		o.Subscribe(nil, nil)
+		if lateErr == nil || lateErr.Error() != "hello world" {
+			t.Error("late error is wrong")
+		}
+	})
+
+	t.Run("late subscription", func(t *testing.T) {
+		o := &Observable[int]{}
+		o.Next(1)
+		a := []int{}
+		o.Subscribe(func(i int) { a = append(a, i) }, nil)
+		o.Next(2)
+		if len(a) != 1 || a[0] != 2 {
+			t.Error("values are wrong")
+		}
+	})
+
+	t.Run("no subscribers", func(t *testing.T) {
+		o := &Observable[int]{}
+		o.Next(1)
+		o.Complete()
+	})
+}
+
+func TestObservable_ToPromise(t *testing.T) {
+	t.Run("value", func(t *testing.T) {
+		o := &Observable[int]{}
+		p := o.ToPromise()
+		o.Next(1)
+		o.Next(2)
+		res, err := p.Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 1 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		o := &Observable[int]{}
+		p := o.ToPromise()
+		o.Error(errors.New("hello world"))
+		if _, err := p.Await(); err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+
+	t.Run("completed", func(t *testing.T) {
+		o := &Observable[int]{}
+		p := o.ToPromise()
+		o.Complete()
+		if _, err := p.Await(); err != ErrCompleted {
+			t.Error("error is not ErrCompleted")
+		}
+		if _, err := o.ToPromise().Await(); err != ErrCompleted {
+			t.Error("error is not ErrCompleted")
+		}
+	})
+
+	t.Run("subscribers bounded", func(t *testing.T) {
+		o := &Observable[int]{}
+		o.Subscribe(func(int) {}, nil)
+		for i := 0; i < 1000; i++ {
+			p := o.ToPromise()
+			o.Next(i)
+			if res, err := p.Await(); err != nil || res != i {
+				t.Fatal("result is wrong")
+			}
+		}
+		count := 0
+		o.lock.Lock()
+		for e := o.subscribers.start; e != nil; e = e.next {
+			count++
+		}
+		o.lock.Unlock()
+		if count != 1 {
+			t.Error("subscribers were not removed:", count)
+		}
+	})
+}
+
+func TestThenDebounced(t *testing.T) {
+	var o Observable[int]
+	ch := make(chan int, 3)
+	ThenDebounced(&o, time.Millisecond*20, func(v int) { ch <- v })
+
+	// Emit three values quickly.
+	o.Next(1)
+	o.Next(2)
+	o.Next(3)
+
+	// Only the last value should be handled.
+	select {
+	case v := <-ch:
+		if v != 3 {
+			t.Error("value is not the last value:", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler was not called")
+	}
+	select {
+	case v := <-ch:
+		t.Error("handler was called again with", v)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
@@ -0,0 +1,61 @@
+package promise
+
+import (
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Defines the pools of promises. This maps the promise type to a *sync.Pool.
+var pools sync.Map
+
+// Defines if a promise was ever recycled. This is 1 once Recycle has been used, so new promises are only taken
+// from the pools when there might be something in them.
+var recycling int32
+
+// Gets the pool for the promise type.
+func getPool[T any]() *sync.Pool {
+	key := reflect.TypeOf((*Promise[T])(nil))
+	if pool, ok := pools.Load(key); ok {
+		return pool.(*sync.Pool)
+	}
+	pool, _ := pools.LoadOrStore(key, &sync.Pool{
+		New: func() interface{} { return &Promise[T]{} },
+	})
+	return pool.(*sync.Pool)
+}
+
+// Gets a blank promise, reusing one that was given to Recycle if there is one.
+func acquire[T any]() *Promise[T] {
+	if atomic.LoadInt32(&recycling) == 0 {
+		return &Promise[T]{}
+	}
+	return getPool[T]().Get().(*Promise[T])
+}
+
+// Recycle is used to reset the promise and put it back into a pool. Promises made by NewFn, Then, Catch, and the
+// other functions which run work will then reuse it instead of allocating, which reduces GC pressure when a lot of
+// short-lived promises are made. If the promise is not done, this does nothing. Otherwise, this waits for the
+// promise to finish settling and for any handlers already added to it to finish running before it is reset.
+//
+// Recycling is dangerous! Once the promise is recycled, it must not be used again anywhere. This includes any
+// code still holding a pointer to it, which would then see a blank promise or a promise it does not own.
+func (p *Promise[T]) Recycle() {
+	// Make sure the promise is done.
+	if _, done := p.Snapshot(); !done {
+		return
+	}
+
+	// Wait for the promise to finish settling and for any handlers to finish running.
+	p.running.Wait()
+
+	// Remove any finalizer, such as the one watching for the rejection not being observed, so it does not run for
+	// whoever gets the promise next.
+	runtime.SetFinalizer(p, nil)
+
+	// Reset the promise and put it into the pool.
+	*p = Promise[T]{}
+	atomic.StoreInt32(&recycling, 1)
+	getPool[T]().Put(p)
+}
@@ -0,0 +1,129 @@
+package promise
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquire(t *testing.T) {
+	t.Run("not recycling", func(t *testing.T) {
+		old := atomic.LoadInt32(&recycling)
+		atomic.StoreInt32(&recycling, 0)
+		defer atomic.StoreInt32(&recycling, old)
+		if p := acquire[string](); p.notDone || p.res != "" {
+			t.Error("promise is not blank")
+		}
+	})
+
+	t.Run("recycled", func(t *testing.T) {
+		// Recycle some promises and make sure new ones made are pending and blank.
+		for i := 0; i < 10; i++ {
+			p := NewFn(func() (string, error) { return "hello world", nil })
+			<-p.Done()
+			p.Recycle()
+		}
+		for i := 0; i < 10; i++ {
+			p := newPending[string]("test")
+			if !p.notDone || p.name != "test" || p.res != "" || p.observed {
+				t.Fatal("promise is not pending and blank")
+			}
+		}
+		res, err := NewFn(func() (string, error) { return "hello world", nil }).Await()
+		if err != nil || res != "hello world" {
+			t.Error("reused promise did not resolve")
+		}
+	})
+}
+
+func TestPromise_Recycle(t *testing.T) {
+	t.Run("pending", func(t *testing.T) {
+		p := &Promise[string]{notDone: true, res: "hello world"}
+		p.Recycle()
+		if p.res != "hello world" {
+			t.Error("pending promise was reset")
+		}
+	})
+
+	t.Run("done", func(t *testing.T) {
+		p := NewRejected[string](errors.New("hello world"))
+		p.name = "hello world"
+		p.Recycle()
+		if p.err != nil || p.name != "" || p.notDone {
+			t.Error("promise was not reset")
+		}
+	})
+
+	t.Run("handlers running", func(t *testing.T) {
+		// Recycle straight after waiting whilst handlers are still being called. Run with -race to check.
+		for i := 0; i < 100; i++ {
+			p := NewFn(func() (string, error) { return "hello world", nil })
+			pending := Then(p, func(s string) (string, error) { return s, nil })
+			_, _ = p.Await()
+			done := Then(p, func(s string) (string, error) { return s, nil })
+			handled := handle(p, func(s string, err error) (string, error) { return s, err })
+			p.Recycle()
+			r := NewRejected[string](errors.New("hello world"))
+			caught := Catch(r, func(err error) (string, error) { return "", nil })
+			r.Recycle()
+			for _, x := range []*Promise[string]{pending, done, caught, handled} {
+				if _, err := x.Await(); err != nil {
+					t.Fatal("error is not nil")
+				}
+			}
+		}
+	})
+
+	t.Run("finalizer", func(t *testing.T) {
+		// Recycle promises which have finalizers set.
+		errRecycled := errors.New("recycled")
+		var reported, cancelled int32
+		SetUnhandledRejectionHandler(func(err error) {
+			if err == errRecycled {
+				atomic.AddInt32(&reported, 1)
+			}
+		})
+		defer SetUnhandledRejectionHandler(nil)
+		func() {
+			NewRejected[string](errRecycled).Recycle()
+			p := ThenAutoCancel(NewResolved("hello world"), func(s string) (string, <-chan struct{}, func(), error) {
+				return s, nil, func() { atomic.AddInt32(&cancelled, 1) }, nil
+			})
+			<-p.Done()
+			p.Recycle()
+		}()
+
+		// The finalizers should have been removed, so nothing is reported or cancelled.
+		for i := 0; i < 5; i++ {
+			runtime.GC()
+			time.Sleep(time.Millisecond * 10)
+		}
+		if atomic.LoadInt32(&reported) != 0 {
+			t.Error("recycled rejection was reported")
+		}
+		if atomic.LoadInt32(&cancelled) != 0 {
+			t.Error("recycled result was cancelled")
+		}
+	})
+}
+
+var benchmarkPromise *Promise[string]
+
+func BenchmarkNewFn(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchmarkPromise = NewFn(func() (string, error) { return "hello world", nil })
+		<-benchmarkPromise.Done()
+	}
+}
+
+func BenchmarkNewFn_Recycle(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchmarkPromise = NewFn(func() (string, error) { return "hello world", nil })
+		<-benchmarkPromise.Done()
+		benchmarkPromise.Recycle()
+	}
+}
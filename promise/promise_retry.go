@@ -0,0 +1,201 @@
+package promise
+
+import (
+	"math/rand"
+	"time"
+)
+
+// ThenRetry behaves the same as Then but calls the handler again with the same value if it returns an error.
+// The handler is called at most the number of attempts specified (and always at least once). If every attempt
+// errors, the new promise rejects with the last error. Errors from the parent promise are passed through
+// without calling the handler.
+func ThenRetry[T any, X any](p *Promise[T], attempts int, f func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (x X, err error) {
+		for i := 0; i == 0 || i < attempts; i++ {
+			x, err = f(res)
+			if err == nil {
+				break
+			}
+		}
+		return
+	})
+}
+
+// Reattempt is used to retry a whole promise. The factory is called to make a new promise, and if it rejects, the
+// factory is called again to make another one. The factory is called at most the number of attempts specified (and
+// always at least once). If every promise rejects, the new promise rejects with the last error.
+func Reattempt[T any](factory func() *Promise[T], attempts int) *Promise[T] {
+	return NewFn(func() (res T, err error) {
+		for i := 0; i == 0 || i < attempts; i++ {
+			res, err = factory().wait()
+			if err == nil {
+				break
+			}
+		}
+		return
+	})
+}
+
+// RetryBackoff is used to call the function until it succeeds, waiting longer between each attempt. The first wait
+// is base and it doubles after each attempt, up to maxDelay. A random amount of up to jitter times the wait is added
+// on top so that many callers do not retry at the same time. The function is called at most the number of attempts
+// specified (and always at least once). If every attempt errors, the promise rejects with the last error.
+func RetryBackoff[T any](attempts int, base time.Duration, maxDelay time.Duration, jitter float64, f func() (T, error)) *Promise[T] {
+	return RetryBackoffRand(attempts, base, maxDelay, jitter, rand.Float64, f)
+}
+
+// RetryBackoffRand behaves the same as RetryBackoff but uses the random source given for the jitter. The random
+// source must return a number from 0 up to but not including 1. This is useful for seeded or deterministic delays.
+func RetryBackoffRand[T any](
+	attempts int, base, maxDelay time.Duration, jitter float64, random func() float64, f func() (T, error),
+) *Promise[T] {
+	return NewFn(func() (T, error) {
+		return retryBackoff(attempts, base, maxDelay, jitter, random, time.Sleep, f)
+	})
+}
+
+// Calls the function with backoff. The random source and sleep function are given so the delays can be tested.
+func retryBackoff[T any](
+	attempts int, base, maxDelay time.Duration, jitter float64,
+	random func() float64, sleep func(time.Duration), f func() (T, error),
+) (res T, err error) {
+	delay := base
+	for i := 0; i == 0 || i < attempts; i++ {
+		if i != 0 {
+			// Wait before the next attempt and double the delay for the one after.
+			if delay > maxDelay {
+				delay = maxDelay
+			}
+			sleep(delay + time.Duration(float64(delay)*jitter*random()))
+			delay *= 2
+		}
+		res, err = f()
+		if err == nil {
+			break
+		}
+	}
+	return
+}
+
+// Hedge is used to call functions one after another until one succeeds, without waiting for slow functions to
+// finish. The first function is called straight away. If it has not returned after the delay (or it errors), the
+// next function is called too, and so on. The first successful result is returned and the rest are ignored.
+// If every function errors, an *AggregateError is returned. If no functions are given, NoPromises is returned.
+func Hedge[T any](delay time.Duration, fns ...func() (T, error)) (T, error) {
+	var zero T
+	if len(fns) == 0 {
+		return zero, NoPromises
+	}
+
+	// Defines the function to start the next function and restart the timer.
+	type result struct {
+		index int
+		res   T
+		err   error
+	}
+	ch := make(chan result, len(fns))
+	started := 0
+	var t *time.Timer
+	startNext := func() {
+		index := started
+		f := fns[index]
+		started++
+		go func() {
+			res, err := f()
+			ch <- result{index: index, res: res, err: err}
+		}()
+		if t != nil {
+			t.Stop()
+		}
+		t = time.NewTimer(delay)
+	}
+
+	// Start the first function.
+	startNext()
+	defer func() { t.Stop() }()
+
+	// Wait for a result.
+	errs := make([]error, len(fns))
+	failed := 0
+	for {
+		select {
+		case r := <-ch:
+			if r.err == nil {
+				return r.res, nil
+			}
+			errs[r.index] = r.err
+			failed++
+			if failed == len(fns) {
+				return zero, &AggregateError{errs: errs}
+			}
+			if started < len(fns) {
+				// Start the next function now rather than waiting for the timer.
+				startNext()
+			}
+		case <-t.C:
+			if started < len(fns) {
+				startNext()
+			}
+		}
+	}
+}
+
+// Speculate is used to call every function at the same time and return the first result which both succeeds and
+// passes validation. If the fastest result is not valid, this keeps waiting for the others. The functions which
+// are still running once there is a winner are left to finish and their results are ignored. If no result passes,
+// an *AggregateError is returned with each error, where results that did not pass validation have ErrValidation.
+// If no functions are given, NoPromises is returned.
+func Speculate[T any](validate func(T) bool, fns ...func() (T, error)) (T, error) {
+	var zero T
+	if len(fns) == 0 {
+		return zero, NoPromises
+	}
+
+	// Start every function. The channel is buffered so nothing is left blocking.
+	type result struct {
+		index int
+		res   T
+		err   error
+	}
+	ch := make(chan result, len(fns))
+	for i, f := range fns {
+		index := i
+		handle(NewFn(f), func(res T, err error) (struct{}, error) {
+			ch <- result{index: index, res: res, err: err}
+			return struct{}{}, nil
+		})
+	}
+
+	// Wait for a valid result.
+	errs := make([]error, len(fns))
+	for range fns {
+		r := <-ch
+		if r.err == nil {
+			if validate(r.res) {
+				return r.res, nil
+			}
+			r.err = ErrValidation
+		}
+		errs[r.index] = r.err
+	}
+	return zero, &AggregateError{errs: errs}
+}
+
+// Degrade is used to call the levels one after another until one succeeds, starting from the best quality. Unlike
+// Hedge, a level is only called once the one before it has errored, so cheaper fallbacks only run when they are
+// needed. The promise resolves with the first successful result. If every level errors, the promise rejects with
+// the last error. If no levels are given, the promise rejects with NoPromises.
+func Degrade[T any](levels ...func() (T, error)) *Promise[T] {
+	return NewFn(func() (T, error) {
+		var zero T
+		err := NoPromises
+		for _, level := range levels {
+			var res T
+			res, err = level()
+			if err == nil {
+				return res, nil
+			}
+		}
+		return zero, err
+	})
+}
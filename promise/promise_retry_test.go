@@ -0,0 +1,355 @@
+package promise
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestThenRetry(t *testing.T) {
+	t.Run("fails then succeeds", func(t *testing.T) {
+		calls := 0
+		p := ThenRetry(NewResolved("hello world"), 3, func(s string) (int, error) {
+			if s != "hello world" {
+				t.Error("value is wrong")
+			}
+			calls++
+			if calls < 3 {
+				return 0, errors.New("try again")
+			}
+			return 10, nil
+		})
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error != nil {
+			t.Fatal("error is not nil")
+		}
+		if res.Result != 10 {
+			t.Error("result is wrong")
+		}
+		if calls != 3 {
+			t.Error("call count is wrong")
+		}
+	})
+
+	t.Run("out of attempts", func(t *testing.T) {
+		calls := 0
+		p := ThenRetry(NewResolved("hello world"), 2, func(s string) (int, error) {
+			calls++
+			return 0, errors.New("hello world")
+		})
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error == nil || res.Error.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+		if calls != 2 {
+			t.Error("call count is wrong")
+		}
+	})
+
+	t.Run("no attempts", func(t *testing.T) {
+		calls := 0
+		p := ThenRetry(NewResolved("hello world"), 0, func(s string) (int, error) {
+			calls++
+			return 1, nil
+		})
+		<-p.Done()
+		if calls != 1 {
+			t.Error("call count is wrong")
+		}
+	})
+
+	t.Run("upstream rejected", func(t *testing.T) {
+		calls := 0
+		p := ThenRetry(NewRejected[string](errors.New("hello world")), 3, func(s string) (int, error) {
+			calls++
+			return 0, nil
+		})
+		<-p.Done()
+		if p.Resolve().Error.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+		if calls != 0 {
+			t.Error("function was called")
+		}
+	})
+}
+
+func TestReattempt(t *testing.T) {
+	t.Run("fails then succeeds", func(t *testing.T) {
+		calls := 0
+		res, err := Reattempt(func() *Promise[string] {
+			calls++
+			n := calls
+			return NewFn(func() (string, error) {
+				if n < 3 {
+					return "", errors.New("try again")
+				}
+				return "hello world", nil
+			})
+		}, 5).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+		if calls != 3 {
+			t.Error("call count is wrong")
+		}
+	})
+
+	t.Run("out of attempts", func(t *testing.T) {
+		calls := 0
+		_, err := Reattempt(func() *Promise[string] {
+			calls++
+			return NewRejected[string](errors.New("hello world"))
+		}, 0).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+		if calls != 1 {
+			t.Error("call count is wrong")
+		}
+	})
+}
+
+func TestHedge(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		_, err := Hedge[string](time.Millisecond)
+		if err != NoPromises {
+			t.Error("no promises error not thrown")
+		}
+	})
+
+	t.Run("first wins", func(t *testing.T) {
+		var calls int32
+		res, err := Hedge(time.Millisecond*50,
+			func() (string, error) {
+				atomic.AddInt32(&calls, 1)
+				return "first", nil
+			},
+			func() (string, error) {
+				atomic.AddInt32(&calls, 1)
+				return "second", nil
+			},
+		)
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "first" {
+			t.Error("result is wrong")
+		}
+		if atomic.LoadInt32(&calls) != 1 {
+			t.Error("second function was called")
+		}
+	})
+
+	t.Run("hedged wins", func(t *testing.T) {
+		res, err := Hedge(time.Millisecond*5,
+			func() (string, error) {
+				time.Sleep(time.Millisecond * 100)
+				return "first", nil
+			},
+			func() (string, error) {
+				return "second", nil
+			},
+		)
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "second" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("error starts next", func(t *testing.T) {
+		start := time.Now()
+		res, err := Hedge(time.Second,
+			func() (string, error) {
+				return "", errors.New("hello world")
+			},
+			func() (string, error) {
+				return "second", nil
+			},
+		)
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "second" {
+			t.Error("result is wrong")
+		}
+		if time.Since(start) > time.Millisecond*500 {
+			t.Error("next function waited for the delay")
+		}
+	})
+
+	t.Run("all error", func(t *testing.T) {
+		_, err := Hedge(time.Millisecond,
+			func() (string, error) {
+				time.Sleep(time.Millisecond * 10)
+				return "", errors.New("hello")
+			},
+			func() (string, error) {
+				return "", errors.New("world")
+			},
+		)
+		var aggr *AggregateError
+		if !errors.As(err, &aggr) {
+			t.Fatal("error is not an aggregate error")
+		}
+		if err.Error() != "hello; world" {
+			t.Error("error is wrong")
+		}
+	})
+}
+
+func TestRetryBackoff(t *testing.T) {
+	t.Run("fails then succeeds", func(t *testing.T) {
+		calls := 0
+		res, err := RetryBackoff(3, time.Millisecond, time.Millisecond*5, 0.5, func() (string, error) {
+			calls++
+			if calls < 3 {
+				return "", errors.New("hello world")
+			}
+			return "hello world", nil
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+		if calls != 3 {
+			t.Error("function was not called 3 times")
+		}
+	})
+
+	t.Run("random source", func(t *testing.T) {
+		randoms := 0
+		calls := 0
+		_, err := RetryBackoffRand(4, time.Millisecond, time.Millisecond*5, 0.5, func() float64 {
+			randoms++
+			return 0
+		}, func() (int, error) {
+			calls++
+			return 0, errors.New("hello world")
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is not the last error")
+		}
+		if calls != 4 {
+			t.Error("function was not called 4 times")
+		}
+		if randoms != 3 {
+			t.Error("random source was not used for each wait")
+		}
+	})
+
+	t.Run("schedule", func(t *testing.T) {
+		for _, r := range []float64{0, 0.5, 0.999} {
+			var delays []time.Duration
+			_, err := retryBackoff(6, time.Millisecond*10, time.Millisecond*50, 0.2,
+				func() float64 { return r },
+				func(d time.Duration) { delays = append(delays, d) },
+				func() (int, error) { return 0, errors.New("hello world") })
+			if err == nil || err.Error() != "hello world" {
+				t.Error("error is not the last error")
+			}
+			expected := []time.Duration{10, 20, 40, 50, 50}
+			if len(delays) != len(expected) {
+				t.Fatal("wrong number of delays")
+			}
+			for i, d := range delays {
+				lo := expected[i] * time.Millisecond
+				hi := lo + lo/5
+				if d < lo || d > hi {
+					t.Errorf("delay %d is %s, expected between %s and %s", i, d, lo, hi)
+				}
+			}
+		}
+	})
+}
+
+func TestSpeculate(t *testing.T) {
+	positive := func(i int) bool { return i > 0 }
+
+	t.Run("no functions", func(t *testing.T) {
+		if _, err := Speculate(positive); err != NoPromises {
+			t.Error("error is not NoPromises")
+		}
+	})
+
+	t.Run("fastest is invalid", func(t *testing.T) {
+		res, err := Speculate(positive,
+			func() (int, error) { return -1, nil },
+			func() (int, error) {
+				time.Sleep(time.Millisecond * 10)
+				return 2, nil
+			},
+		)
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 2 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("nothing valid", func(t *testing.T) {
+		_, err := Speculate(positive,
+			func() (int, error) { return -1, nil },
+			func() (int, error) { return 0, errors.New("hello world") },
+		)
+		var aggErr *AggregateError
+		if !errors.As(err, &aggErr) {
+			t.Fatal("error is not an aggregate error")
+		}
+		errs := aggErr.Errors()
+		if errs[0] != ErrValidation || errs[1] == nil || errs[1].Error() != "hello world" {
+			t.Error("errors are wrong")
+		}
+	})
+}
+
+func TestDegrade(t *testing.T) {
+	t.Run("second level", func(t *testing.T) {
+		called := false
+		res, err := Degrade(
+			func() (string, error) { return "", errors.New("hello world") },
+			func() (string, error) { return "cached", nil },
+			func() (string, error) {
+				called = true
+				return "default", nil
+			},
+		).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "cached" {
+			t.Error("result is wrong")
+		}
+		if called {
+			t.Error("lower level was called")
+		}
+	})
+
+	t.Run("all fail", func(t *testing.T) {
+		_, err := Degrade(
+			func() (string, error) { return "", errors.New("first") },
+			func() (string, error) { return "", errors.New("last") },
+		).Await()
+		if err == nil || err.Error() != "last" {
+			t.Error("error is not the last error")
+		}
+	})
+
+	t.Run("no levels", func(t *testing.T) {
+		_, err := Degrade[string]().Await()
+		if err != NoPromises {
+			t.Error("error is not NoPromises")
+		}
+	})
+}
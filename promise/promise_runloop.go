@@ -0,0 +1,75 @@
+package promise
+
+import "sync"
+
+// RunLoop is used to run functions on a single go-routine. This is useful for code which must only touch state
+// from one go-routine.
+type RunLoop struct {
+	queue    chan func()
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewRunLoop is used to create a run loop and start its go-routine.
+func NewRunLoop() *RunLoop {
+	l := &RunLoop{
+		queue:  make(chan func()),
+		stopCh: make(chan struct{}),
+	}
+	go l.loop()
+	return l
+}
+
+// Runs functions from the queue until the loop is stopped.
+func (l *RunLoop) loop() {
+	for {
+		select {
+		case f := <-l.queue:
+			f()
+		case <-l.stopCh:
+			return
+		}
+	}
+}
+
+// Run is used to run a function on the loop go-routine. This blocks until the loop picks up the function. If the
+// loop is stopped, this returns false and the function is not run.
+func (l *RunLoop) Run(f func()) bool {
+	// Check if the loop is stopped first, since the loop could still pick up the function otherwise.
+	select {
+	case <-l.stopCh:
+		return false
+	default:
+	}
+
+	// Send the function to the loop.
+	select {
+	case l.queue <- f:
+		return true
+	case <-l.stopCh:
+		return false
+	}
+}
+
+// Stop is used to stop the loop go-routine. Any function which is already running will finish.
+func (l *RunLoop) Stop() {
+	l.stopOnce.Do(func() { close(l.stopCh) })
+}
+
+// ThenOn behaves the same as Then but the handler is run on the go-routine of the loop rather than the go-routine
+// which resolved the promise. If the loop is stopped before the handler can run, the new promise rejects with
+// ErrCanceled.
+func ThenOn[T any, X any](loop *RunLoop, p *Promise[T], f func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (x X, err error) {
+		done := make(chan struct{})
+		if !loop.Run(func() {
+			defer close(done)
+			x, err = f(res)
+		}) {
+			err = ErrCanceled
+			return
+		}
+		<-done
+		return
+	})
+}
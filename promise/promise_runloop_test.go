@@ -0,0 +1,80 @@
+package promise
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunLoop_Run(t *testing.T) {
+	loop := NewRunLoop()
+
+	// Block the loop.
+	release := make(chan struct{})
+	if !loop.Run(func() { <-release }) {
+		t.Fatal("function was not run")
+	}
+
+	// Stop the loop whilst a function is waiting.
+	result := make(chan bool)
+	go func() {
+		result <- loop.Run(func() {
+			t.Error("function was called")
+		})
+	}()
+	time.Sleep(time.Millisecond * 5)
+	loop.Stop()
+	if <-result {
+		t.Error("function was run after stop")
+	}
+	close(release)
+}
+
+func TestThenOn(t *testing.T) {
+	loop := NewRunLoop()
+	defer loop.Stop()
+
+	// Get the go-routine of the loop.
+	var loopID string
+	done := make(chan struct{})
+	loop.Run(func() {
+		loopID = goroutineID()
+		close(done)
+	})
+	<-done
+
+	t.Run("resolved", func(t *testing.T) {
+		p := ThenOn(loop, NewResolved("hello world"), func(s string) (string, error) {
+			return goroutineID(), nil
+		})
+		id, err := p.Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if id != loopID {
+			t.Error("handler did not run on the loop")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		p := ThenOn(loop, NewResolved("hello world"), func(s string) (string, error) {
+			return "", errors.New("hello world")
+		})
+		if _, err := p.Await(); err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		stopped := NewRunLoop()
+		stopped.Stop()
+		stopped.Stop()
+		p := ThenOn(stopped, NewResolved("hello world"), func(s string) (string, error) {
+			t.Error("function was called")
+			return s, nil
+		})
+		if _, err := p.Await(); err != ErrCanceled {
+			t.Error("error is not ErrCanceled")
+		}
+	})
+}
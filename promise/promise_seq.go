@@ -0,0 +1,19 @@
+//go:build go1.23
+
+package promise
+
+import "iter"
+
+// Seq is used to create an iterator over the results of the promises for use with range. Each promise is waited
+// on in the order given. This is built on Iterator, so nothing is done with a promise until the loop reaches it.
+// If the loop is broken out of early, no handlers are added to the promises after it and nothing is left running.
+func Seq[T any](promises ...*Promise[T]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		next := Iterator(promises...)
+		for val, end, err := next(); !end; val, end, err = next() {
+			if !yield(val, err) {
+				return
+			}
+		}
+	}
+}
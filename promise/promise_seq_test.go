@@ -0,0 +1,85 @@
+//go:build go1.23
+
+package promise
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSeq(t *testing.T) {
+	promises := []*Promise[string]{
+		NewResolved("a"),
+		NewRejected[string](errors.New("hello world")),
+		NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 5)
+			return "c", nil
+		}),
+	}
+	i := 0
+	for val, err := range Seq(promises...) {
+		switch i {
+		case 0:
+			if err != nil || val != "a" {
+				t.Error("first value is wrong")
+			}
+		case 1:
+			if err == nil || err.Error() != "hello world" {
+				t.Error("error is wrong")
+			}
+		case 2:
+			if err != nil || val != "c" {
+				t.Error("third value is wrong")
+			}
+		}
+		i++
+	}
+	if i != 3 {
+		t.Error("wrong number of values")
+	}
+
+	// Breaking out of the loop should stop the iteration.
+	n := 0
+	for range Seq(promises...) {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Error("iteration did not stop")
+	}
+}
+
+func TestSeq_Break(t *testing.T) {
+	gate := make(chan struct{})
+	defer close(gate)
+	pending := func() *Promise[string] {
+		return NewFn(func() (string, error) {
+			<-gate
+			return "hello world", nil
+		})
+	}
+	first := NewFn(func() (string, error) {
+		time.Sleep(time.Millisecond * 5)
+		return "first", nil
+	})
+	rest := []*Promise[string]{pending(), pending()}
+
+	// Break after the first value.
+	for val, err := range Seq(append([]*Promise[string]{first}, rest...)...) {
+		if err != nil || val != "first" {
+			t.Error("first value is wrong")
+		}
+		break
+	}
+
+	// Make sure nothing was attached to the rest.
+	for i, p := range rest {
+		p.lock.Lock()
+		attached := p.thenStack.start != nil || p.errorStack.start != nil || p.observed
+		p.lock.Unlock()
+		if attached {
+			t.Errorf("handlers were attached to promise %d", i+1)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package promise
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StageStat is the timing of a stage made with ThenNamed.
+type StageStat struct {
+	// Count is how many times the stage handler was called.
+	Count int
+
+	// Total is the total time spent in the stage handler.
+	Total time.Duration
+
+	// Average is the average time spent in the stage handler.
+	Average time.Duration
+}
+
+// Defines the timing of each stage.
+var (
+	stageStatsLock sync.Mutex
+	stageStats     = map[string]*StageStat{}
+)
+
+// Records a call of the stage.
+func recordStage(name string, d time.Duration) {
+	stageStatsLock.Lock()
+	defer stageStatsLock.Unlock()
+	stat := stageStats[name]
+	if stat == nil {
+		stat = &StageStat{}
+		stageStats[name] = stat
+	}
+	stat.Count++
+	stat.Total += d
+}
+
+// StageStats is used to get the timing of every stage made with ThenNamed by the name of the stage.
+func StageStats() map[string]StageStat {
+	stageStatsLock.Lock()
+	defer stageStatsLock.Unlock()
+	m := make(map[string]StageStat, len(stageStats))
+	for name, stat := range stageStats {
+		s := *stat
+		s.Average = s.Total / time.Duration(s.Count)
+		m[name] = s
+	}
+	return m
+}
+
+// ResetStageStats is used to clear the timing of every stage.
+func ResetStageStats() {
+	stageStatsLock.Lock()
+	defer stageStatsLock.Unlock()
+	stageStats = map[string]*StageStat{}
+}
+
+// ThenNamed behaves the same as Then but the new promise has the name specified. The time taken by the handler is
+// recorded against the name, and can be read with StageStats.
+func ThenNamed[T any, X any](p *Promise[T], name string, f func(T) (X, error)) *Promise[X] {
+	return then(p, name, 0, func(res T) (X, error) {
+		start := time.Now()
+		defer func() { recordStage(name, time.Since(start)) }()
+		return f(res)
+	})
+}
+
+// ThenSlowLog behaves the same as Then but times the handler and calls logf with how long it took if it took longer
+// than the threshold. This is a cheap way to spot slow stages without logging every call. The handler is timed
+// whether it succeeds or errors.
+func ThenSlowLog[T any, X any](threshold time.Duration, logf func(dur time.Duration), p *Promise[T], f func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		start := time.Now()
+		defer func() {
+			if d := time.Since(start); d > threshold {
+				logf(d)
+			}
+		}()
+		return f(res)
+	})
+}
+
+// Defines the upper bounds of the settle duration histogram buckets.
+var settleBuckets = [...]time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Defines the built in metrics. These are all only changed atomically.
+var metrics struct {
+	created  uint64
+	resolved uint64
+	rejected uint64
+	timedOut uint64
+	panics   uint64
+
+	settleCount   uint64
+	settleSum     uint64
+	settleBuckets [len(settleBuckets)]uint64
+}
+
+// Records how long a promise function took to settle.
+func recordSettle(d time.Duration) {
+	atomic.AddUint64(&metrics.settleCount, 1)
+	atomic.AddUint64(&metrics.settleSum, uint64(d))
+	for i, bound := range settleBuckets {
+		if d <= bound {
+			atomic.AddUint64(&metrics.settleBuckets[i], 1)
+			return
+		}
+	}
+}
+
+// HistogramBucket is a bucket of a histogram.
+type HistogramBucket struct {
+	// UpperBound is the largest duration counted in the bucket.
+	UpperBound time.Duration
+
+	// Count is how many durations were less than or equal to the upper bound. This includes smaller buckets.
+	Count uint64
+}
+
+// Histogram is a histogram of durations.
+type Histogram struct {
+	// Buckets are the buckets of the histogram from smallest to largest. Durations larger than the last bucket are
+	// only included in Count.
+	Buckets []HistogramBucket
+
+	// Count is how many durations were recorded.
+	Count uint64
+
+	// Sum is the total of every duration recorded.
+	Sum time.Duration
+}
+
+// MetricsSnapshot is a snapshot of the built in metrics. The counts are since the program started.
+type MetricsSnapshot struct {
+	// Created is how many promises were created. This does not include promises made without a constructor.
+	Created uint64
+
+	// Resolved is how many promises resolved.
+	Resolved uint64
+
+	// Rejected is how many promises rejected.
+	Rejected uint64
+
+	// TimedOut is how many times a timeout was hit by Timeout, AwaitTimeout, or something built on them.
+	TimedOut uint64
+
+	// Panics is how many panics were recovered and turned into errors.
+	Panics uint64
+
+	// SettleDurations is how long promise functions took to resolve or reject.
+	SettleDurations Histogram
+}
+
+// Metrics is used to get a snapshot of the built in metrics. These are always collected, so nothing needs to be
+// set up. Use WriteOpenMetrics to expose them to a scraper.
+func Metrics() MetricsSnapshot {
+	// Load the buckets before the count. recordSettle adds to the count first, so this means the buckets can never
+	// add up to more than the count.
+	buckets := make([]HistogramBucket, len(settleBuckets))
+	var total uint64
+	for i, bound := range settleBuckets {
+		total += atomic.LoadUint64(&metrics.settleBuckets[i])
+		buckets[i] = HistogramBucket{UpperBound: bound, Count: total}
+	}
+	return MetricsSnapshot{
+		Created:  atomic.LoadUint64(&metrics.created),
+		Resolved: atomic.LoadUint64(&metrics.resolved),
+		Rejected: atomic.LoadUint64(&metrics.rejected),
+		TimedOut: atomic.LoadUint64(&metrics.timedOut),
+		Panics:   atomic.LoadUint64(&metrics.panics),
+		SettleDurations: Histogram{
+			Buckets: buckets,
+			Count:   atomic.LoadUint64(&metrics.settleCount),
+			Sum:     time.Duration(atomic.LoadUint64(&metrics.settleSum)),
+		},
+	}
+}
+
+// WriteOpenMetrics is used to write the snapshot in the OpenMetrics text format.
+func (s MetricsSnapshot) WriteOpenMetrics(w io.Writer) error {
+	var b strings.Builder
+	counter := func(name, help string, v uint64) {
+		fmt.Fprintf(&b, "# TYPE %s counter\n# HELP %s %s\n%s_total %d\n", name, name, help, name, v)
+	}
+	counter("promise_created", "Promises created.", s.Created)
+	counter("promise_resolved", "Promises resolved.", s.Resolved)
+	counter("promise_rejected", "Promises rejected.", s.Rejected)
+	counter("promise_timed_out", "Promise timeouts hit.", s.TimedOut)
+	counter("promise_panics", "Panics recovered.", s.Panics)
+
+	h := s.SettleDurations
+	b.WriteString("# TYPE promise_settle_seconds histogram\n")
+	b.WriteString("# UNIT promise_settle_seconds seconds\n")
+	b.WriteString("# HELP promise_settle_seconds How long promise functions took to settle.\n")
+	for _, bucket := range h.Buckets {
+		fmt.Fprintf(&b, "promise_settle_seconds_bucket{le=\"%g\"} %d\n", bucket.UpperBound.Seconds(), bucket.Count)
+	}
+	fmt.Fprintf(&b, "promise_settle_seconds_bucket{le=\"+Inf\"} %d\n", h.Count)
+	fmt.Fprintf(&b, "promise_settle_seconds_count %d\n", h.Count)
+	fmt.Fprintf(&b, "promise_settle_seconds_sum %g\n", h.Sum.Seconds())
+	b.WriteString("# EOF\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
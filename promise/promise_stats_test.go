@@ -0,0 +1,210 @@
+package promise
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThenNamed(t *testing.T) {
+	ResetStageStats()
+	defer ResetStageStats()
+
+	// Call the stage a few times.
+	for i := 0; i < 3; i++ {
+		p := ThenNamed(NewResolved(i), "double", func(i int) (int, error) {
+			time.Sleep(time.Millisecond)
+			return i * 2, nil
+		})
+		if p.Name() != "double" {
+			t.Error("name is wrong")
+		}
+		res, err := p.Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != i*2 {
+			t.Error("result is wrong")
+		}
+	}
+
+	// Check the stats.
+	stat, ok := StageStats()["double"]
+	if !ok {
+		t.Fatal("stage was not recorded")
+	}
+	if stat.Count != 3 {
+		t.Error("count is wrong")
+	}
+	if stat.Total < time.Millisecond*3 {
+		t.Error("total is wrong")
+	}
+	if stat.Average != stat.Total/3 {
+		t.Error("average is wrong")
+	}
+}
+
+func TestThenSlowLog(t *testing.T) {
+	var logged []time.Duration
+	logf := func(d time.Duration) { logged = append(logged, d) }
+
+	t.Run("fast", func(t *testing.T) {
+		logged = nil
+		res, err := ThenSlowLog(time.Millisecond*50, logf, NewResolved("hello world"), func(s string) (int, error) {
+			return len(s), nil
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 11 {
+			t.Error("result is wrong")
+		}
+		if len(logged) != 0 {
+			t.Error("fast stage was logged")
+		}
+	})
+
+	t.Run("slow", func(t *testing.T) {
+		logged = nil
+		_, err := ThenSlowLog(time.Millisecond*5, logf, NewResolved("hello world"), func(s string) (int, error) {
+			time.Sleep(time.Millisecond * 10)
+			return 0, errors.New("hello world")
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+		if len(logged) != 1 || logged[0] < time.Millisecond*10 {
+			t.Error("slow stage was not logged")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		logged = nil
+		_, err := ThenSlowLog(0, logf, NewRejected[string](errors.New("hello world")), func(s string) (int, error) {
+			t.Error("handler was called")
+			return 0, nil
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+		if len(logged) != 0 {
+			t.Error("rejection was logged")
+		}
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	before := Metrics()
+
+	// Create a mix of promises.
+	_ = NewResolved("hello world")
+	_ = NewRejected[string](errors.New("hello world"))
+	_ = Catch(NewResolved("hello world"), func(error) (string, error) { return "", nil })
+	_, _ = NewFn(func() (string, error) { return "hello world", nil }).Await()
+	_, _ = NewFn(func() (string, error) { return "", errors.New("hello world") }).Await()
+	_, _ = ThenDefer(NewResolved("hello world"), func(s string) (string, error) { panic(s) }, func(string, error) {}).Await()
+	gate := make(chan struct{})
+	defer close(gate)
+	pending := NewFn(func() (string, error) {
+		<-gate
+		return "hello world", nil
+	})
+	_, _ = pending.AwaitTimeout(time.Millisecond)
+	_, _ = Timeout(pending, time.Millisecond).Await()
+
+	// Check the counts. Other tests might still be finishing, so these are at least what we expect.
+	after := Metrics()
+	check := func(name string, before, after, expected uint64) {
+		if after-before < expected {
+			t.Errorf("%s was %d, expected at least %d", name, after-before, expected)
+		}
+	}
+	check("created", before.Created, after.Created, 10)
+	check("resolved", before.Resolved, after.Resolved, 5)
+	check("rejected", before.Rejected, after.Rejected, 4)
+	check("timed out", before.TimedOut, after.TimedOut, 2)
+	check("panics", before.Panics, after.Panics, 1)
+	check("settle count", before.SettleDurations.Count, after.SettleDurations.Count, 4)
+
+	// Check the histogram is cumulative.
+	h := after.SettleDurations
+	if len(h.Buckets) != len(settleBuckets) {
+		t.Fatal("wrong number of buckets")
+	}
+	for i := 1; i < len(h.Buckets); i++ {
+		if h.Buckets[i].Count < h.Buckets[i-1].Count {
+			t.Error("buckets are not cumulative")
+		}
+	}
+	if h.Buckets[len(h.Buckets)-1].Count > h.Count {
+		t.Error("bucket count is larger than the total")
+	}
+}
+
+func TestRecordSettle(t *testing.T) {
+	before := Metrics().SettleDurations
+	recordSettle(time.Minute)
+	after := Metrics().SettleDurations
+	if after.Count-before.Count < 1 || after.Sum-before.Sum < time.Minute {
+		t.Error("duration was not recorded")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("hello world")
+}
+
+func TestMetricsSnapshot_WriteOpenMetrics(t *testing.T) {
+	s := MetricsSnapshot{
+		Created:  5,
+		Resolved: 3,
+		Rejected: 2,
+		TimedOut: 1,
+		SettleDurations: Histogram{
+			Buckets: []HistogramBucket{
+				{UpperBound: time.Millisecond, Count: 3},
+				{UpperBound: time.Second, Count: 4},
+			},
+			Count: 5,
+			Sum:   time.Second * 3,
+		},
+	}
+	var b strings.Builder
+	if err := s.WriteOpenMetrics(&b); err != nil {
+		t.Fatal("error is not nil")
+	}
+	expected := `# TYPE promise_created counter
+# HELP promise_created Promises created.
+promise_created_total 5
+# TYPE promise_resolved counter
+# HELP promise_resolved Promises resolved.
+promise_resolved_total 3
+# TYPE promise_rejected counter
+# HELP promise_rejected Promises rejected.
+promise_rejected_total 2
+# TYPE promise_timed_out counter
+# HELP promise_timed_out Promise timeouts hit.
+promise_timed_out_total 1
+# TYPE promise_panics counter
+# HELP promise_panics Panics recovered.
+promise_panics_total 0
+# TYPE promise_settle_seconds histogram
+# UNIT promise_settle_seconds seconds
+# HELP promise_settle_seconds How long promise functions took to settle.
+promise_settle_seconds_bucket{le="0.001"} 3
+promise_settle_seconds_bucket{le="1"} 4
+promise_settle_seconds_bucket{le="+Inf"} 5
+promise_settle_seconds_count 5
+promise_settle_seconds_sum 3
+# EOF
+`
+	if b.String() != expected {
+		t.Errorf("output is wrong:\n%s", b.String())
+	}
+	if s.WriteOpenMetrics(failingWriter{}) == nil {
+		t.Error("write error was not returned")
+	}
+}
@@ -0,0 +1,97 @@
+package promise
+
+// ThenStream is used to turn the result of the promise into a stream of values. When the promise resolves, the
+// handler is called with a function that sends a value down the returned channel. Note the channel is unbuffered,
+// so emit blocks until the value is received. When the handler returns, the channel is closed. If the handler
+// returns an error, or the promise rejects, the error is sent as a final resolution before the channel is closed.
+func ThenStream[T any, X any](p *Promise[T], f func(T, func(X)) error) <-chan PromiseResolution[X] {
+	ch := make(chan PromiseResolution[X])
+	go func() {
+		// Close the channel when we are done.
+		defer close(ch)
+
+		// Wait for the promise.
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error != nil {
+			ch <- PromiseResolution[X]{Error: res.Error}
+			return
+		}
+
+		// Call the handler.
+		emit := func(x X) {
+			ch <- PromiseResolution[X]{Result: x}
+		}
+		if err := f(res.Result, emit); err != nil {
+			ch <- PromiseResolution[X]{Error: err}
+		}
+	}()
+	return ch
+}
+
+// ThenChan is used to create a promise which resolves with every value read from the channel returned by the
+// handler. The values are read until the channel is closed, so the handler must make sure it is closed.
+// If the promise rejects, the handler is not called and the error is passed through.
+func ThenChan[T any, X any](p *Promise[T], f func(T) <-chan X) *Promise[[]X] {
+	return Then(p, func(res T) ([]X, error) {
+		var values []X
+		for x := range f(res) {
+			values = append(values, x)
+		}
+		return values, nil
+	})
+}
+
+// ThenChanResults behaves the same as ThenChan but the channel carries resolutions, such as the channel returned by
+// ThenStream. The channel is always read until it is closed. If any resolution has an error, the new promise
+// rejects with the first error.
+func ThenChanResults[T any, X any](p *Promise[T], f func(T) <-chan PromiseResolution[X]) *Promise[[]X] {
+	return Then(p, func(res T) ([]X, error) {
+		var values []X
+		var firstErr error
+		for r := range f(res) {
+			if r.Error != nil {
+				if firstErr == nil {
+					firstErr = r.Error
+				}
+				continue
+			}
+			values = append(values, r.Result)
+		}
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return values, nil
+	})
+}
+
+// Defines how many values MapStream processes ahead of the value it is waiting to send.
+const mapStreamAhead = 64
+
+// MapStream is used to call the function on every value read from the channel at the same time, sending the
+// resolutions down the returned channel in the same order the values were read. Each call is made in its own
+// promise, so results which are done early are held until the results before them are sent. Up to 64 values are
+// processed ahead of the one being waited on. The returned channel is closed once the input channel is closed and
+// every resolution has been sent.
+func MapStream[T any, X any](in <-chan T, f func(T) (X, error)) <-chan PromiseResolution[X] {
+	out := make(chan PromiseResolution[X])
+	pending := make(chan *Promise[X], mapStreamAhead)
+
+	// Start a promise for each value.
+	go func() {
+		defer close(pending)
+		for v := range in {
+			pending <- NewFnWithArg(v, f)
+		}
+	}()
+
+	// Send the resolutions in order.
+	go func() {
+		defer close(out)
+		for p := range pending {
+			res, err := p.wait()
+			out <- PromiseResolution[X]{Result: res, Error: err}
+		}
+	}()
+	return out
+}
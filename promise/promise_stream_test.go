@@ -0,0 +1,162 @@
+package promise
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThenStream(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ch := ThenStream(NewResolved("a,b,c"), func(s string, emit func(string)) error {
+			for _, v := range strings.Split(s, ",") {
+				emit(v)
+			}
+			return nil
+		})
+		a := []string{}
+		for res := range ch {
+			if res.Error != nil {
+				t.Fatal("error is not nil")
+			}
+			a = append(a, res.Result)
+		}
+		if len(a) != 3 || a[0] != "a" || a[1] != "b" || a[2] != "c" {
+			t.Error("values are wrong")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ch := ThenStream(NewResolved("a"), func(s string, emit func(string)) error {
+			emit(s)
+			return errors.New("hello world")
+		})
+		res := []PromiseResolution[string]{}
+		for r := range ch {
+			res = append(res, r)
+		}
+		if len(res) != 2 {
+			t.Fatal("length is wrong")
+		}
+		if res[0].Result != "a" || res[0].Error != nil {
+			t.Error("value is wrong")
+		}
+		if res[1].Error == nil || res[1].Error.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+
+	t.Run("upstream rejected", func(t *testing.T) {
+		ch := ThenStream(NewRejected[string](errors.New("hello world")), func(s string, emit func(string)) error {
+			t.Error("function was called")
+			return nil
+		})
+		res := []PromiseResolution[string]{}
+		for r := range ch {
+			res = append(res, r)
+		}
+		if len(res) != 1 || res[0].Error == nil || res[0].Error.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+}
+
+func TestThenChan(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		res, err := ThenChan(NewResolved("a,b,c"), func(s string) <-chan string {
+			ch := make(chan string)
+			go func() {
+				defer close(ch)
+				for _, v := range strings.Split(s, ",") {
+					ch <- v
+				}
+			}()
+			return ch
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if strings.Join(res, "") != "abc" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := ThenChan(NewRejected[string](errors.New("hello world")), func(s string) <-chan string {
+			t.Error("handler was called")
+			return nil
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
+
+func TestThenChanResults(t *testing.T) {
+	split := func(s string, emit func(string)) error {
+		for _, v := range strings.Split(s, ",") {
+			emit(v)
+		}
+		return nil
+	}
+
+	t.Run("success", func(t *testing.T) {
+		res, err := ThenChanResults(NewResolved("a,b,c"), func(s string) <-chan PromiseResolution[string] {
+			return ThenStream(NewResolved(s), split)
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if strings.Join(res, "") != "abc" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := ThenChanResults(NewResolved(""), func(s string) <-chan PromiseResolution[string] {
+			ch := make(chan PromiseResolution[string], 3)
+			ch <- PromiseResolution[string]{Error: errors.New("first")}
+			ch <- PromiseResolution[string]{Error: errors.New("second")}
+			ch <- PromiseResolution[string]{Result: "a"}
+			close(ch)
+			return ch
+		}).Await()
+		if err == nil || err.Error() != "first" {
+			t.Error("error is not the first error")
+		}
+	})
+}
+
+func TestMapStream(t *testing.T) {
+	in := make(chan int)
+	go func() {
+		defer close(in)
+		for i := 0; i < 5; i++ {
+			in <- i
+		}
+	}()
+
+	// Later values finish first.
+	out := MapStream(in, func(i int) (int, error) {
+		time.Sleep(time.Millisecond * time.Duration(5-i) * 5)
+		if i == 3 {
+			return 0, errors.New("hello world")
+		}
+		return i * 10, nil
+	})
+	i := 0
+	for r := range out {
+		if i == 3 {
+			if r.Error == nil || r.Error.Error() != "hello world" {
+				t.Error("error is wrong")
+			}
+		} else if r.Error != nil || r.Result != i*10 {
+			t.Errorf("resolution %d is wrong", i)
+		}
+		i++
+	}
+	if i != 5 {
+		t.Error("wrong number of resolutions")
+	}
+}
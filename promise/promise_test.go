@@ -1,13 +1,64 @@
 package promise
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 )
 
+func TestStack_pushPriority(t *testing.T) {
+	var s stack
+	s.pushPriority("a", 0)
+	s.pushPriority("b", 0)
+	s.pushPriority("c", 5)
+	s.pushPriority("d", -1)
+	s.pushPriority("e", 1)
+	s.pushPriority("f", 5)
+	s.pushPriority("g", 1)
+	var order string
+	for e := s.start; e != nil; e = e.next {
+		order += e.value.(string)
+	}
+	if order != "cfegabd" {
+		t.Error("order is wrong:", order)
+	}
+	if s.end.value != "d" {
+		t.Error("end is wrong")
+	}
+}
+
+func TestStack_remove(t *testing.T) {
+	var s stack
+	s.push("a")
+	s.push("b")
+	s.push("c")
+	snapshot := s.start
+	s.remove("b")
+	s.remove("d")
+	var order string
+	for e := s.start; e != nil; e = e.next {
+		order += e.value.(string)
+	}
+	if order != "ac" {
+		t.Error("order is wrong:", order)
+	}
+	if s.end.value != "c" {
+		t.Error("end is wrong")
+	}
+	if snapshot.next.value != "b" {
+		t.Error("snapshot was changed")
+	}
+	s.remove("a")
+	s.remove("c")
+	if s.start != nil || s.end != nil {
+		t.Error("stack is not empty")
+	}
+}
+
 func TestPromise_Resolve(t *testing.T) {
 	t.Run("unresolved", func(t *testing.T) {
 		p := &Promise[string]{notDone: true}
@@ -54,6 +105,427 @@ func TestPromise_Resolve(t *testing.T) {
 	})
 }
 
+func TestPromiseResolution_PanicValue(t *testing.T) {
+	t.Run("panic", func(t *testing.T) {
+		p := ThenDefer(NewResolved("hello world"), func(s string) (string, error) {
+			panic(s)
+		}, func(string, error) {})
+		<-p.Done()
+		v, ok := p.Resolve().PanicValue()
+		if !ok {
+			t.Fatal("panic value not found")
+		}
+		if v != "hello world" {
+			t.Error("panic value is wrong")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		v, ok := NewRejected[string](errors.New("hello world")).Resolve().PanicValue()
+		if ok || v != nil {
+			t.Error("panic value found")
+		}
+	})
+
+	t.Run("resolved", func(t *testing.T) {
+		v, ok := NewResolved("hello world").Resolve().PanicValue()
+		if ok || v != nil {
+			t.Error("panic value found")
+		}
+	})
+}
+
+func TestPromise_Snapshot(t *testing.T) {
+	t.Run("unresolved", func(t *testing.T) {
+		p := &Promise[string]{notDone: true, res: "hello world"}
+		res, ok := p.Snapshot()
+		if ok {
+			t.Error("promise should be unresolved")
+		}
+		if res.Result != "" || res.Error != nil {
+			t.Error("resolution is not blank")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		p := NewRejected[string](errors.New("hello world"))
+		res, ok := p.Snapshot()
+		if !ok {
+			t.Fatal("promise should be resolved")
+		}
+		if res.Error == nil || res.Error.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+
+	t.Run("resolved", func(t *testing.T) {
+		p := NewResolved("hello world")
+		res, ok := p.Snapshot()
+		if !ok {
+			t.Fatal("promise should be resolved")
+		}
+		if res.Error != nil {
+			t.Error("error is not nil")
+		}
+		if res.Result != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+}
+
+func TestPromise_ResolveInto(t *testing.T) {
+	t.Run("unresolved", func(t *testing.T) {
+		p := &Promise[string]{notDone: true, res: "hello world"}
+		var (
+			res string
+			err error
+		)
+		if p.ResolveInto(&res, &err) {
+			t.Error("promise should be unresolved")
+		}
+		if res != "" {
+			t.Error("result was written")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		p := NewRejected[string](errors.New("hello world"))
+		var (
+			res string
+			err error
+		)
+		if !p.ResolveInto(&res, &err) {
+			t.Fatal("promise should be resolved")
+		}
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+
+	t.Run("resolved", func(t *testing.T) {
+		p := NewResolved("hello world")
+		var (
+			res string
+			err error
+		)
+		if !p.ResolveInto(&res, &err) {
+			t.Fatal("promise should be resolved")
+		}
+		if err != nil {
+			t.Error("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+}
+
+func BenchmarkPromise_ResolveInto(b *testing.B) {
+	p := NewResolved("hello world")
+	var (
+		res string
+		err error
+	)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if !p.ResolveInto(&res, &err) {
+			b.Fatal("promise should be resolved")
+		}
+	}
+}
+
+func BenchmarkPromise_Resolve(b *testing.B) {
+	p := NewResolved("hello world")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if p.Resolve() == nil {
+			b.Fatal("promise should be resolved")
+		}
+	}
+}
+
+func BenchmarkPromise_Snapshot(b *testing.B) {
+	p := NewResolved("hello world")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, ok := p.Snapshot(); !ok {
+			b.Fatal("promise should be resolved")
+		}
+	}
+}
+
+func TestPromise_Done(t *testing.T) {
+	t.Run("already done", func(t *testing.T) {
+		p := NewResolved("hello world")
+		select {
+		case <-p.Done():
+		default:
+			t.Error("channel is not closed")
+		}
+	})
+
+	t.Run("pending", func(t *testing.T) {
+		p := NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 10)
+			return "hello world", nil
+		})
+		ch := p.Done()
+		if ch != p.Done() {
+			t.Error("channel is not reused")
+		}
+		select {
+		case <-ch:
+			t.Error("channel is closed too early")
+		default:
+		}
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("channel was not closed")
+		}
+		if p.Resolve() == nil {
+			t.Error("promise should be resolved")
+		}
+	})
+}
+
+func TestPromise_ResolveContext(t *testing.T) {
+	t.Run("already done", func(t *testing.T) {
+		p := NewResolved("hello world")
+		res, err := p.ResolveContext(context.Background())
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res.Result != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("pending", func(t *testing.T) {
+		p := NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 5)
+			return "", errors.New("hello world")
+		})
+		res, err := p.ResolveContext(context.Background())
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res.Error == nil || res.Error.Error() != "hello world" {
+			t.Error("promise error is wrong")
+		}
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		p := NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 20)
+			return "hello world", nil
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(time.Millisecond * 5)
+			cancel()
+		}()
+		res, err := p.ResolveContext(ctx)
+		if err != context.Canceled {
+			t.Error("error is not context cancelled")
+		}
+		if res != nil {
+			t.Error("resolution is not nil")
+		}
+		if p.Resolve() != nil {
+			t.Error("promise should be unaffected")
+		}
+	})
+}
+
+func TestPromise_Await(t *testing.T) {
+	t.Run("resolved", func(t *testing.T) {
+		res, err := NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 5)
+			return "hello world", nil
+		}).Await()
+		if err != nil {
+			t.Error("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := NewRejected[string](errors.New("hello world")).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+
+	t.Run("default timeout", func(t *testing.T) {
+		SetDefaultTimeout(time.Millisecond * 5)
+		defer SetDefaultTimeout(0)
+		_, err := (&Promise[string]{notDone: true}).Await()
+		if err != ErrTimeout {
+			t.Error("error is not ErrTimeout")
+		}
+	})
+}
+
+func TestPromise_AwaitTimeout(t *testing.T) {
+	t.Run("in time", func(t *testing.T) {
+		res, err := NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 5)
+			return "hello world", nil
+		}).AwaitTimeout(time.Second)
+		if err != nil {
+			t.Error("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		_, err := (&Promise[string]{notDone: true}).AwaitTimeout(time.Millisecond * 5)
+		if err != ErrTimeout {
+			t.Error("error is not ErrTimeout")
+		}
+	})
+}
+
+func TestPromise_NotifyAll(t *testing.T) {
+	t.Run("resolved", func(t *testing.T) {
+		a := make(chan PromiseResolution[string], 1)
+		b := make(chan PromiseResolution[string], 1)
+		full := make(chan PromiseResolution[string])
+		p := NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 5)
+			return "hello world", nil
+		})
+		p.NotifyAll(a, full, b)
+		for _, ch := range []chan PromiseResolution[string]{a, b} {
+			select {
+			case res := <-ch:
+				if res.Error != nil {
+					t.Error("error is not nil")
+				}
+				if res.Result != "hello world" {
+					t.Error("result is wrong")
+				}
+			case <-time.After(time.Second):
+				t.Fatal("resolution was not sent")
+			}
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		a := make(chan PromiseResolution[string], 1)
+		b := make(chan PromiseResolution[string], 1)
+		p := NewRejected[string](errors.New("hello world"))
+		p.NotifyAll(a, b)
+		for _, ch := range []chan PromiseResolution[string]{a, b} {
+			select {
+			case res := <-ch:
+				if res.Error == nil || res.Error.Error() != "hello world" {
+					t.Error("error is wrong")
+				}
+			case <-time.After(time.Second):
+				t.Fatal("resolution was not sent")
+			}
+		}
+	})
+}
+
+func TestPromise_Meta(t *testing.T) {
+	t.Run("no meta", func(t *testing.T) {
+		if NewResolved("hello world").Meta() != nil {
+			t.Error("meta is not nil")
+		}
+	})
+
+	t.Run("propagates", func(t *testing.T) {
+		p := NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 5)
+			return "hello world", nil
+		}).WithMeta(Meta{"request_id": "abc"})
+		a := Then(p, func(s string) (int, error) {
+			return 0, errors.New("hello world")
+		})
+		b := Catch(a, func(err error) (int, error) {
+			return 1, nil
+		})
+		c := Then(b, func(i int) (int, error) {
+			return i + 1, nil
+		})
+		<-c.Done()
+		d := handle(c, func(i int, err error) (int, error) {
+			return i, err
+		})
+		<-d.Done()
+		for _, m := range []Meta{a.Meta(), b.Meta(), c.Meta(), d.Meta()} {
+			if m["request_id"] != "abc" {
+				t.Error("meta was not passed down")
+			}
+		}
+	})
+}
+
+func TestThenPriority(t *testing.T) {
+	for _, reject := range []bool{false, true} {
+		gate := make(chan struct{})
+		p := NewFn(func() (string, error) {
+			<-gate
+			if reject {
+				return "", errors.New("hello world")
+			}
+			return "hello world", nil
+		})
+
+		// Add the handlers out of order. Rejections are passed down in the same order.
+		var lock sync.Mutex
+		var order []int
+		var promises []*Promise[struct{}]
+		for _, priority := range []int{0, 10, -5, 5} {
+			priority := priority
+			child := ThenPriority(p, priority, func(string) (struct{}, error) {
+				return struct{}{}, nil
+			})
+			promises = append(promises, handle(child, func(struct{}, error) (struct{}, error) {
+				lock.Lock()
+				order = append(order, priority)
+				lock.Unlock()
+				return struct{}{}, nil
+			}))
+		}
+		close(gate)
+		for _, c := range promises {
+			_, _ = c.Await()
+		}
+		if fmt.Sprint(order) != "[10 5 0 -5]" {
+			t.Error("order is wrong:", order)
+		}
+	}
+}
+
+func TestPromise_Context(t *testing.T) {
+	t.Run("no context", func(t *testing.T) {
+		if NewResolved("hello world").Context() != context.Background() {
+			t.Error("context is not the background context")
+		}
+	})
+
+	t.Run("propagates", func(t *testing.T) {
+		type key struct{}
+		ctx := context.WithValue(context.Background(), key{}, "abc")
+		p := NewResolved("hello world").WithContext(ctx)
+		a := Then(p, func(s string) (string, error) { return s, nil })
+		b := Catch(a, func(err error) (string, error) { return "", nil })
+		for _, c := range []context.Context{a.Context(), b.Context()} {
+			if c.Value(key{}) != "abc" {
+				t.Error("context was not passed down")
+			}
+		}
+	})
+}
+
 func TestNewFn(t *testing.T) {
 	t.Run("resolved", func(t *testing.T) {
 		p := NewFn(func() (string, error) {
@@ -102,6 +574,17 @@ func TestNewFn(t *testing.T) {
 		}
 	})
 
+	t.Run("nil function", func(t *testing.T) {
+		p := NewFn[string](nil)
+		res := p.Resolve()
+		if res == nil {
+			t.Fatal("promise should be resolved")
+		}
+		if res.Error != ErrNilFunc {
+			t.Error("error is not ErrNilFunc")
+		}
+	})
+
 	t.Run("then chain", func(t *testing.T) {
 		// Create the then handler.
 		p := NewFn(func() (string, error) {
@@ -238,6 +721,160 @@ func TestNewFnWithArg(t *testing.T) {
 	}
 }
 
+func TestNewOnce(t *testing.T) {
+	t.Run("concurrent", func(t *testing.T) {
+		var calls int32
+		get := NewOnce(func() (int, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(time.Millisecond * 10)
+			return 1, nil
+		})
+		promises := make([]*Promise[int], 10)
+		for i := range promises {
+			promises[i] = get()
+		}
+		for _, p := range promises {
+			res, err := p.Await()
+			if err != nil {
+				t.Fatal("error is not nil")
+			}
+			if res != 1 {
+				t.Error("result is wrong")
+			}
+		}
+		if atomic.LoadInt32(&calls) != 1 {
+			t.Error("compute was not called exactly once")
+		}
+	})
+
+	t.Run("not waited on", func(t *testing.T) {
+		ran := make(chan struct{})
+		get := NewOnce(func() (int, error) {
+			close(ran)
+			return 1, nil
+		})
+		_ = get()
+		select {
+		case <-ran:
+		case <-time.After(time.Second):
+			t.Error("compute did not run on the first call")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		get := NewOnce(func() (int, error) {
+			return 0, errors.New("hello world")
+		})
+		for i := 0; i < 2; i++ {
+			_, err := get().Await()
+			if err == nil || err.Error() != "hello world" {
+				t.Error("error is wrong")
+			}
+		}
+	})
+}
+
+func TestPromise_AddWarning(t *testing.T) {
+	errPartial := errors.New("partial data")
+	errDeprecated := errors.New("deprecated")
+	gated := func(err error) (*Promise[string], func()) {
+		gate := make(chan struct{})
+		p := NewFn(func() (string, error) {
+			<-gate
+			return "hello world", err
+		})
+		p.AddWarning(errPartial)
+		return p, func() { close(gate) }
+	}
+	checkWarnings := func(t *testing.T, res *PromiseResolution[string], expected ...error) {
+		t.Helper()
+		if len(res.Warnings) != len(expected) {
+			t.Fatalf("expected %d warnings, got %d", len(expected), len(res.Warnings))
+		}
+		for i, w := range expected {
+			if res.Warnings[i] != w {
+				t.Errorf("warning %d is wrong", i)
+			}
+		}
+	}
+
+	t.Run("resolution is not shared", func(t *testing.T) {
+		p := NewResolved("hello world")
+		p.AddWarning(errPartial)
+		p.AddWarning(errDeprecated)
+		p.AddWarning(errPartial)
+		res := p.Resolve()
+		res.Warnings = append(res.Warnings, errors.New("caller"))
+		snap, _ := p.Snapshot()
+		snap.Warnings = append(snap.Warnings, errors.New("caller"))
+		p.AddWarning(errDeprecated)
+		checkWarnings(t, p.Resolve(), errPartial, errDeprecated, errPartial, errDeprecated)
+		if res.Warnings[3].Error() != "caller" || snap.Warnings[3].Error() != "caller" {
+			t.Error("caller warnings were overwritten")
+		}
+	})
+
+	t.Run("then pending", func(t *testing.T) {
+		p, release := gated(nil)
+		child := Then(p, func(s string) (string, error) { return s, nil })
+		child.AddWarning(errDeprecated)
+		release()
+		_, _ = child.Await()
+		checkWarnings(t, child.Resolve(), errPartial, errDeprecated)
+	})
+
+	t.Run("then pending rejected", func(t *testing.T) {
+		p, release := gated(errors.New("hello world"))
+		child := Then(p, func(s string) (string, error) { return s, nil })
+		release()
+		_, _ = child.Await()
+		checkWarnings(t, child.Resolve(), errPartial)
+	})
+
+	t.Run("catch pending", func(t *testing.T) {
+		p, release := gated(errors.New("hello world"))
+		child := Catch(p, func(err error) (string, error) { return "", nil })
+		release()
+		_, _ = child.Await()
+		checkWarnings(t, child.Resolve(), errPartial)
+	})
+
+	t.Run("handle pending", func(t *testing.T) {
+		for _, err := range []error{nil, errors.New("hello world")} {
+			p, release := gated(err)
+			child := handle(p, func(s string, err error) (string, error) { return s, nil })
+			release()
+			_, _ = child.Await()
+			checkWarnings(t, child.Resolve(), errPartial)
+		}
+	})
+
+	t.Run("done", func(t *testing.T) {
+		p := NewResolved("hello world")
+		p.AddWarning(errPartial)
+		child := Then(p, func(s string) (string, error) { return s, nil })
+		child.AddWarning(errDeprecated)
+		_, _ = child.Await()
+		checkWarnings(t, child.Resolve(), errPartial, errDeprecated)
+
+		// Make sure the children do not share warnings.
+		other := Then(p, func(s string) (string, error) { return s, nil })
+		_, _ = other.Await()
+		checkWarnings(t, other.Resolve(), errPartial)
+	})
+
+	t.Run("no warnings", func(t *testing.T) {
+		p, release := gated(nil)
+		p.warnings = nil
+		child := Then(p, func(s string) (string, error) { return s, nil })
+		release()
+		_, _ = child.Await()
+		if res, _ := child.Snapshot(); res.Warnings != nil {
+			t.Error("warnings are not nil")
+		}
+	})
+}
+
 func TestNewResolved(t *testing.T) {
 	p := NewResolved("hello world!")
 	if p.notDone {
@@ -456,3 +1093,65 @@ func TestCatch(t *testing.T) {
 		}
 	})
 }
+
+func TestHandle(t *testing.T) {
+	f := func(s string, err error) (string, error) {
+		if err != nil {
+			return "error " + err.Error(), nil
+		}
+		return "result " + s, nil
+	}
+	tests := []struct {
+		name    string
+		promise func() *Promise[string]
+		wants   string
+	}{
+		{
+			name: "pending resolve",
+			promise: func() *Promise[string] {
+				return NewFn(func() (string, error) {
+					time.Sleep(time.Millisecond * 5)
+					return "hello world", nil
+				})
+			},
+			wants: "result hello world",
+		},
+		{
+			name: "pending reject",
+			promise: func() *Promise[string] {
+				return NewFn(func() (string, error) {
+					time.Sleep(time.Millisecond * 5)
+					return "ignored", errors.New("hello world")
+				})
+			},
+			wants: "error hello world",
+		},
+		{
+			name: "resolved",
+			promise: func() *Promise[string] {
+				return NewResolved("hello world")
+			},
+			wants: "result hello world",
+		},
+		{
+			name: "rejected",
+			promise: func() *Promise[string] {
+				return &Promise[string]{res: "ignored", err: errors.New("hello world")}
+			},
+			wants: "error hello world",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := handle(tt.promise(), f)
+			<-p.Done()
+			res := p.Resolve()
+			if res.Error != nil {
+				t.Fatal("error is not nil")
+			}
+			if res.Result != tt.wants {
+				t.Error("result is wrong")
+			}
+		})
+	}
+}
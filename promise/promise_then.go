@@ -0,0 +1,398 @@
+package promise
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ThenMethod behaves the same as Then but binds a receiver to the handler.
+// This allows you to pass a method expression such as (*Service).Process without wrapping it in a closure.
+func ThenMethod[R any, T any, X any](p *Promise[T], recv R, m func(R, T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) { return m(recv, res) })
+}
+
+// Chain is used to apply a number of stages to the result of the promise in order. Each stage is given the
+// result of the last stage. If a stage errors, the remaining stages are not called and the new promise rejects.
+func Chain[T any](p *Promise[T], stages ...func(T) (T, error)) *Promise[T] {
+	return Then(p, func(res T) (T, error) {
+		for _, stage := range stages {
+			var err error
+			if res, err = stage(res); err != nil {
+				return res, err
+			}
+		}
+		return res, nil
+	})
+}
+
+// ThenWith behaves the same as Then but resolves with both the value given to the handler and the value it
+// returned. This is useful when later stages need access to both.
+func ThenWith[T any, X any](p *Promise[T], f func(T) (X, error)) *Promise[struct {
+	In  T
+	Out X
+}] {
+	return Then(p, func(res T) (v struct {
+		In  T
+		Out X
+	}, err error) {
+		v.In = res
+		v.Out, err = f(res)
+		return
+	})
+}
+
+// ThenMaybe behaves the same as Then but the handler can choose not to keep the value. If the handler returns
+// false, the new promise resolves with a nil pointer. Otherwise, it resolves with a pointer to the value.
+func ThenMaybe[T any, X any](p *Promise[T], f func(T) (X, bool, error)) *Promise[*X] {
+	return Then(p, func(res T) (*X, error) {
+		x, keep, err := f(res)
+		if err != nil || !keep {
+			return nil, err
+		}
+		return &x, nil
+	})
+}
+
+// ThenDefer behaves the same as Then but calls cleanup with the result of the handler once it returns. This is
+// useful for releasing resources used by the handler. If the handler panics, the panic is recovered and cleanup
+// is called with a *PanicError, which the new promise then rejects with. If the promise rejects, neither the
+// handler nor cleanup is called.
+func ThenDefer[T any, X any](p *Promise[T], f func(T) (X, error), cleanup func(X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		x, err := recoverCall(func() (X, error) { return f(res) })
+		cleanup(x, err)
+		return x, err
+	})
+}
+
+// Fork is used to run a number of handlers at the same time on the result of the promise. The new promise
+// resolves with the results of the handlers in the same order. If one handler errors, the new promise rejects
+// with the error. If the promise rejects, none of the handlers are called.
+func Fork[T any, X any](p *Promise[T], fns ...func(T) (X, error)) *Promise[[]X] {
+	return Then(p, func(res T) ([]X, error) {
+		promises := make([]*Promise[X], len(fns))
+		for i, f := range fns {
+			promises[i] = NewFnWithArg(res, f)
+		}
+		return All(promises...)
+	})
+}
+
+// FanOut is used to run the handler at the same time for each key on the result of the promise. The new promise
+// resolves with the results of the handler by key. If one call errors, the new promise rejects with the error.
+// If the promise rejects, the handler is not called.
+func FanOut[T any, K comparable, V any](p *Promise[T], keys []K, f func(T, K) (V, error)) *Promise[map[K]V] {
+	return Then(p, func(res T) (map[K]V, error) {
+		promises := make([]*Promise[V], len(keys))
+		for i, k := range keys {
+			k := k
+			promises[i] = NewFn(func() (V, error) { return f(res, k) })
+		}
+		values, err := All(promises...)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[K]V, len(keys))
+		for i, k := range keys {
+			m[k] = values[i]
+		}
+		return m, nil
+	})
+}
+
+// ThenAll behaves the same as Then but the handler returns promises to wait for. The new promise resolves with their
+// results in order once they have all resolved, or rejects with the first error. This is useful when the number of
+// promises to fan out to depends on the result. If the promise rejects, the handler is not called.
+func ThenAll[T any, X any](p *Promise[T], f func(T) []*Promise[X]) *Promise[[]X] {
+	return Then(p, func(res T) ([]X, error) {
+		return All(f(res)...)
+	})
+}
+
+// ForkLimited behaves the same as Fork but only runs up to the limit of handlers at the same time. The rest are
+// queued until a handler finishes. If a handler errors, any handlers still queued are not called.
+func ForkLimited[T any, X any](p *Promise[T], limit int, fns ...func(T) (X, error)) *Promise[[]X] {
+	return Then(p, func(res T) ([]X, error) {
+		// Defines the first error.
+		var (
+			lock     sync.Mutex
+			firstErr error
+		)
+
+		// Create a promise for each handler which waits for the semaphore.
+		s := NewSemaphore(limit)
+		promises := make([]*Promise[X], len(fns))
+		for i, f := range fns {
+			fn := f
+			promises[i] = NewFnWithSemaphore(s, func() (X, error) {
+				// If a handler already errored, do not call this one.
+				lock.Lock()
+				err := firstErr
+				lock.Unlock()
+				if err != nil {
+					var zero X
+					return zero, err
+				}
+
+				// Call the handler.
+				x, err := fn(res)
+				if err != nil {
+					lock.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					lock.Unlock()
+				}
+				return x, err
+			})
+		}
+		return All(promises...)
+	})
+}
+
+// Gate is used to hold back the resolution of the promise until the returned release function is called. The new
+// promise will not resolve or reject until both the promise is done and the gate is released, even if the promise
+// is already done. Calling release more than once does nothing.
+func Gate[T any](p *Promise[T]) (*Promise[T], func()) {
+	// Defines the release channel.
+	releaseCh := make(chan struct{})
+	var once sync.Once
+	release := func() {
+		once.Do(func() { close(releaseCh) })
+	}
+
+	// Create the gated promise.
+	newPromise := NewFn(func() (T, error) {
+		<-releaseCh
+		return p.wait()
+	})
+	return newPromise, release
+}
+
+// ThenCollect behaves the same as Then but also sends the result of the handler to the channel if it succeeds.
+// Nothing is sent if the handler or promise errors. Note the send blocks until the channel can take the value, and
+// the new promise will not resolve until then.
+func ThenCollect[T any, X any](p *Promise[T], out chan<- X, f func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		x, err := f(res)
+		if err == nil {
+			out <- x
+		}
+		return x, err
+	})
+}
+
+// Redirect is used to continue the chain from another promise. When the promise resolves, the handler is called to
+// get the next promise, and the new promise resolves or rejects the same as that one. If either promise rejects,
+// the new promise rejects with the error.
+func Redirect[T any](p *Promise[T], f func(T) *Promise[T]) *Promise[T] {
+	return Then(p, func(res T) (T, error) {
+		return f(res).wait()
+	})
+}
+
+// ThenDefaults behaves the same as Then but resolves with the defaults if the handler errors. Errors from the
+// promise itself are still passed through.
+func ThenDefaults[T any, X any](p *Promise[T], defaults []X, f func(T) ([]X, error)) *Promise[[]X] {
+	return Then(p, func(res T) ([]X, error) {
+		x, err := f(res)
+		if err != nil {
+			return defaults, nil
+		}
+		return x, nil
+	})
+}
+
+// ThenTranslate behaves the same as Then but passes any error through errMap before the new promise rejects. This
+// includes errors from the promise itself. This is useful for turning internal errors into errors for a boundary.
+func ThenTranslate[T any, X any](p *Promise[T], f func(T) (X, error), errMap func(error) error) *Promise[X] {
+	return handle(p, func(res T, err error) (x X, _ error) {
+		if err == nil {
+			x, err = f(res)
+		}
+		if err != nil {
+			err = errMap(err)
+		}
+		return x, err
+	})
+}
+
+// LimitSize is used to create a promise which rejects with ErrTooLarge if the size of the result is over maxBytes.
+// The size is worked out with the sizeof function given. Otherwise, the result and any error are passed through.
+func LimitSize[T any](p *Promise[T], maxBytes int, sizeof func(T) int) *Promise[T] {
+	return Then(p, func(res T) (T, error) {
+		if size := sizeof(res); size > maxBytes {
+			var zero T
+			return zero, fmt.Errorf("%w: %d bytes is over the limit of %d bytes", ErrTooLarge, size, maxBytes)
+		}
+		return res, nil
+	})
+}
+
+// Tee is used to call the sink with the resolution of the promise and then pass the result and error through
+// unchanged. The sink sees both results and errors, and is called before any handlers on the new promise.
+// This is useful for audit logging.
+func Tee[T any](p *Promise[T], sink func(PromiseResolution[T])) *Promise[T] {
+	return handle(p, func(res T, err error) (T, error) {
+		sink(PromiseResolution[T]{Result: res, Error: err})
+		return res, err
+	})
+}
+
+// Coerce is used to validate the result of the promise and turn it into a new type. This is the same as Then, but
+// marks the validation step in a pipeline. If the coercion function returns an error, it is wrapped in a
+// *ValidationError so handlers further down can check for ErrValidation with errors.Is. Errors from the promise
+// are passed through without being wrapped.
+func Coerce[T any, X any](p *Promise[T], coerce func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		x, err := coerce(res)
+		if err != nil {
+			return x, &ValidationError{Err: err}
+		}
+		return x, nil
+	})
+}
+
+// ThenWarn behaves the same as Then but the handler is given a function to add warnings to the new promise.
+// This lets the handler succeed whilst still reporting soft issues such as partial data. See AddWarning.
+func ThenWarn[T any, X any](p *Promise[T], f func(res T, warn func(error)) (X, error)) *Promise[X] {
+	// Make sure the new promise is set before the handler uses it.
+	ready := make(chan struct{})
+	var newPromise *Promise[X]
+	newPromise = Then(p, func(res T) (X, error) {
+		<-ready
+		return f(res, newPromise.AddWarning)
+	})
+	close(ready)
+	return newPromise
+}
+
+// Explode is used to split the slice the promise resolves with into a promise for each item. As the length is not
+// known until the promise resolves, this returns a promise which resolves with the resolved promises for each item
+// in order. Each of these can then be chained separately. If the promise rejects, the new promise rejects too.
+func Explode[T any](p *Promise[[]T]) *Promise[[]*Promise[T]] {
+	return Then(p, func(items []T) ([]*Promise[T], error) {
+		promises := make([]*Promise[T], len(items))
+		for i, item := range items {
+			promises[i] = NewResolved(item)
+		}
+		return promises, nil
+	})
+}
+
+// ThenCompensate behaves the same as Then but also returns a function to undo the handler, for saga style workflows
+// where a later failure means earlier steps must be rolled back. The compensate function waits for the new promise
+// and, if it resolved, calls undo with the result and returns its error. If the new promise rejected, there is
+// nothing to undo, so nil is returned. Undo is only called once, and later calls return the same error.
+func ThenCompensate[T any, X any](p *Promise[T], do func(T) (X, error), undo func(X) error) (*Promise[X], func() error) {
+	newPromise := Then(p, do)
+	var (
+		once    sync.Once
+		undoErr error
+	)
+	compensate := func() error {
+		once.Do(func() {
+			if x, err := newPromise.wait(); err == nil {
+				undoErr = undo(x)
+			}
+		})
+		return undoErr
+	}
+	return newPromise, compensate
+}
+
+// ThenWithResource behaves the same as Then but acquires a resource for the handler to use. The release function
+// returned by acquire is always called once the handler returns, even if it errors. If the handler panics, the
+// panic is recovered and the new promise rejects with a *PanicError after the resource is released. If acquire
+// errors, the handler is not called and the new promise rejects with the error. If the promise rejects, acquire
+// is not called.
+func ThenWithResource[T any, R any, X any](p *Promise[T], acquire func() (R, func(), error), f func(T, R) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		r, release, err := acquire()
+		if err != nil {
+			var zero X
+			return zero, err
+		}
+		defer release()
+		return recoverCall(func() (X, error) { return f(res, r) })
+	})
+}
+
+// ErrorAccumulator is used to collect errors from many stages so they can be reported together at the end. This is
+// safe to use from many go-routines. The zero value is ready to use.
+type ErrorAccumulator struct {
+	// defines the lock for the errors.
+	lock sync.Mutex
+
+	// defines the errors in the order they were added.
+	errs []error
+}
+
+// Add is used to add an error to the accumulator. Nil errors are ignored.
+func (a *ErrorAccumulator) Add(err error) {
+	if err == nil {
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.errs = append(a.errs, err)
+}
+
+// Errors is used to get a copy of the errors in the order they were added.
+func (a *ErrorAccumulator) Errors() []error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return append([]error(nil), a.errs...)
+}
+
+// Err is used to get the errors as an *AggregateError. This is nil if there are no errors.
+func (a *ErrorAccumulator) Err() error {
+	errs := a.Errors()
+	if len(errs) == 0 {
+		return nil
+	}
+	return &AggregateError{errs: errs}
+}
+
+// ThenAccumulate behaves the same as Then but if the handler errors, the error is added to the accumulator and the
+// new promise resolves with the zero value instead of rejecting. This lets best-effort pipelines carry on past
+// failures and report them all at the end. Errors from the promise are passed through and are not added.
+func ThenAccumulate[T any, X any](errs *ErrorAccumulator, p *Promise[T], f func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		x, err := f(res)
+		if err != nil {
+			errs.Add(err)
+			var zero X
+			return zero, nil
+		}
+		return x, nil
+	})
+}
+
+// Branch behaves the same as Then but the result is routed to one of two handlers. If pred returns true, ifTrue is
+// called, otherwise ifFalse is called. The new promise resolves or rejects with the output of the handler chosen.
+// If the promise rejects, neither handler is called.
+func Branch[T any, X any](p *Promise[T], pred func(T) bool, ifTrue func(T) (X, error), ifFalse func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		if pred(res) {
+			return ifTrue(res)
+		}
+		return ifFalse(res)
+	})
+}
+
+// Switch behaves the same as Branch but the result is looked up in the cases, and the matching function is called.
+// If no case matches, def is called with the result. If def is nil, the new promise rejects with ErrNilFunc
+// instead. If the promise rejects, nothing is called.
+func Switch[T comparable, X any](p *Promise[T], cases map[T]func() (X, error), def func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		if f, ok := cases[res]; ok {
+			return f()
+		}
+		if def == nil {
+			var zero X
+			return zero, ErrNilFunc
+		}
+		return def(res)
+	})
+}
@@ -0,0 +1,950 @@
+package promise
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type thenMethodService struct {
+	prefix string
+}
+
+func (s *thenMethodService) process(v string) (string, error) {
+	return s.prefix + v, nil
+}
+
+func TestThenMethod(t *testing.T) {
+	svc := &thenMethodService{prefix: "hello "}
+	p := ThenMethod(NewResolved("world"), svc, (*thenMethodService).process)
+	<-p.Done()
+	res := p.Resolve()
+	if res.Error != nil {
+		t.Fatal("error is not nil")
+	}
+	if res.Result != "hello world" {
+		t.Error("result is wrong")
+	}
+}
+
+func TestChain(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		p := Chain(NewResolved(1),
+			func(i int) (int, error) { return i + 1, nil },
+			func(i int) (int, error) { return i * 10, nil },
+			func(i int) (int, error) { return i - 5, nil },
+		)
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error != nil {
+			t.Fatal("error is not nil")
+		}
+		if res.Result != 15 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		called := false
+		p := Chain(NewResolved(1),
+			func(i int) (int, error) { return i + 1, nil },
+			func(i int) (int, error) { return 0, errors.New("hello world") },
+			func(i int) (int, error) {
+				called = true
+				return i, nil
+			},
+		)
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error == nil || res.Error.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+		if called {
+			t.Error("stage after error was called")
+		}
+	})
+
+	t.Run("no stages", func(t *testing.T) {
+		p := Chain(NewResolved(1))
+		<-p.Done()
+		if p.Resolve().Result != 1 {
+			t.Error("result is wrong")
+		}
+	})
+}
+
+func TestThenWith(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		p := ThenWith(NewResolved("hello world"), func(s string) (int, error) {
+			return len(s), nil
+		})
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error != nil {
+			t.Fatal("error is not nil")
+		}
+		if res.Result.In != "hello world" {
+			t.Error("input is wrong")
+		}
+		if res.Result.Out != 11 {
+			t.Error("output is wrong")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		p := ThenWith(NewResolved("hello world"), func(s string) (int, error) {
+			return 0, errors.New("hello world")
+		})
+		<-p.Done()
+		if p.Resolve().Error == nil {
+			t.Error("error is nil")
+		}
+	})
+
+	t.Run("upstream rejected", func(t *testing.T) {
+		p := ThenWith(NewRejected[string](errors.New("hello world")), func(s string) (int, error) {
+			t.Error("function was called")
+			return 0, nil
+		})
+		<-p.Done()
+		if p.Resolve().Error.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+}
+
+func TestThenMaybe(t *testing.T) {
+	f := func(i int) (string, bool, error) {
+		switch i {
+		case 0:
+			return "", false, nil
+		case 1:
+			return "hello world", true, nil
+		default:
+			return "", false, errors.New("hello world")
+		}
+	}
+
+	t.Run("keep", func(t *testing.T) {
+		p := ThenMaybe(NewResolved(1), f)
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error != nil {
+			t.Fatal("error is not nil")
+		}
+		if res.Result == nil || *res.Result != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		p := ThenMaybe(NewResolved(0), f)
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error != nil {
+			t.Fatal("error is not nil")
+		}
+		if res.Result != nil {
+			t.Error("result is not nil")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		p := ThenMaybe(NewResolved(2), f)
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error == nil || res.Error.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+		if res.Result != nil {
+			t.Error("result is not nil")
+		}
+	})
+}
+
+func TestThenDefer(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		var (
+			cleanupRes int
+			cleanupErr error
+		)
+		p := ThenDefer(NewResolved("hello world"), func(s string) (int, error) {
+			return len(s), nil
+		}, func(i int, err error) {
+			cleanupRes = i
+			cleanupErr = err
+		})
+		<-p.Done()
+		if p.Resolve().Result != 11 {
+			t.Error("result is wrong")
+		}
+		if cleanupRes != 11 || cleanupErr != nil {
+			t.Error("cleanup did not see the result")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var cleanupErr error
+		p := ThenDefer(NewResolved("hello world"), func(s string) (int, error) {
+			return 0, errors.New("hello world")
+		}, func(i int, err error) {
+			cleanupErr = err
+		})
+		<-p.Done()
+		if p.Resolve().Error == nil {
+			t.Error("error is nil")
+		}
+		if cleanupErr == nil || cleanupErr.Error() != "hello world" {
+			t.Error("cleanup did not see the error")
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		var cleanupErr error
+		p := ThenDefer(NewResolved("hello world"), func(s string) (int, error) {
+			panic(s)
+		}, func(i int, err error) {
+			cleanupErr = err
+		})
+		<-p.Done()
+		var panicErr *PanicError
+		if !errors.As(p.Resolve().Error, &panicErr) || panicErr.Value != "hello world" {
+			t.Error("error is not the panic")
+		}
+		if cleanupErr != p.Resolve().Error {
+			t.Error("cleanup did not see the panic")
+		}
+	})
+}
+
+func TestFork(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		p := Fork(NewResolved(2),
+			func(i int) (int, error) { return i + 1, nil },
+			func(i int) (int, error) { return i * 10, nil },
+			func(i int) (int, error) { return i - 5, nil },
+		)
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error != nil {
+			t.Fatal("error is not nil")
+		}
+		if len(res.Result) != 3 || res.Result[0] != 3 || res.Result[1] != 20 || res.Result[2] != -3 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		p := Fork(NewResolved(2),
+			func(i int) (int, error) { return i + 1, nil },
+			func(i int) (int, error) { return 0, errors.New("hello world") },
+			func(i int) (int, error) { return i - 5, nil },
+		)
+		<-p.Done()
+		res := p.Resolve()
+		if res.Error == nil || res.Error.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+
+	t.Run("upstream rejected", func(t *testing.T) {
+		p := Fork(NewRejected[int](errors.New("hello world")), func(i int) (int, error) {
+			t.Error("function was called")
+			return 0, nil
+		})
+		<-p.Done()
+		if p.Resolve().Error.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+}
+
+func TestThenAll(t *testing.T) {
+	t.Run("resolved", func(t *testing.T) {
+		res, err := ThenAll(NewResolved("a,b,c"), func(s string) []*Promise[string] {
+			var promises []*Promise[string]
+			for _, part := range strings.Split(s, ",") {
+				promises = append(promises, NewFnWithArg(part, func(part string) (string, error) {
+					return strings.ToUpper(part), nil
+				}))
+			}
+			return promises
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if strings.Join(res, ",") != "A,B,C" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("item rejected", func(t *testing.T) {
+		_, err := ThenAll(NewResolved(2), func(i int) []*Promise[int] {
+			return []*Promise[int]{NewResolved(i), NewRejected[int](errors.New("hello world"))}
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := ThenAll(NewRejected[int](errors.New("hello world")), func(i int) []*Promise[int] {
+			t.Error("handler was called")
+			return nil
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
+
+func TestFanOut(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		res, err := FanOut(NewResolved(10), []string{"eu", "us", "asia"}, func(base int, region string) (int, error) {
+			return base + len(region), nil
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if len(res) != 3 || res["eu"] != 12 || res["us"] != 12 || res["asia"] != 14 {
+			t.Error("result is wrong:", res)
+		}
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		_, err := FanOut(NewResolved(10), []string{"eu", "us"}, func(base int, region string) (int, error) {
+			if region == "us" {
+				return 0, errors.New("hello world")
+			}
+			return base, nil
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := FanOut(NewRejected[int](errors.New("hello world")), []string{"eu"}, func(base int, region string) (int, error) {
+			t.Error("handler was called")
+			return 0, nil
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
+
+func TestForkLimited(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		var running, max int32
+		fns := make([]func(int) (int, error), 10)
+		for i := range fns {
+			x := i
+			fns[i] = func(v int) (int, error) {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond * 2)
+				atomic.AddInt32(&running, -1)
+				return v + x, nil
+			}
+		}
+		res, err := ForkLimited(NewResolved(10), 3, fns...).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		for i, v := range res {
+			if v != 10+i {
+				t.Error("result is wrong")
+			}
+		}
+		if m := atomic.LoadInt32(&max); m > 3 {
+			t.Errorf("max concurrency was %d", m)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var calls int32
+		fns := make([]func(int) (int, error), 6)
+		for i := range fns {
+			fns[i] = func(int) (int, error) {
+				atomic.AddInt32(&calls, 1)
+				return 0, errors.New("hello world")
+			}
+		}
+		_, err := ForkLimited(NewResolved(10), 1, fns...).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+		if c := atomic.LoadInt32(&calls); c != 1 {
+			t.Errorf("%d handlers were called", c)
+		}
+	})
+}
+
+func TestGate(t *testing.T) {
+	p := NewResolved("hello world")
+	gated, release := Gate(p)
+	var fired uintptr
+	x := Then(gated, func(s string) (string, error) {
+		atomic.StoreUintptr(&fired, 1)
+		return s, nil
+	})
+	time.Sleep(time.Millisecond * 10)
+	if atomic.LoadUintptr(&fired) != 0 {
+		t.Fatal("handler fired before release")
+	}
+	if gated.Resolve() != nil {
+		t.Fatal("gated promise resolved before release")
+	}
+	release()
+	release()
+	res, err := x.Await()
+	if err != nil {
+		t.Fatal("error is not nil")
+	}
+	if res != "hello world" {
+		t.Error("result is wrong")
+	}
+	if atomic.LoadUintptr(&fired) != 1 {
+		t.Error("handler did not fire")
+	}
+}
+
+func TestThenCollect(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		out := make(chan int, 2)
+		p := ThenCollect(NewResolved("hello world"), out, func(s string) (int, error) {
+			return len(s), nil
+		})
+		res, err := p.Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 11 {
+			t.Error("result is wrong")
+		}
+		if len(out) != 1 || <-out != 11 {
+			t.Error("value was not sent once")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		out := make(chan int, 2)
+		p := ThenCollect(NewResolved("hello world"), out, func(s string) (int, error) {
+			return 0, errors.New("hello world")
+		})
+		if _, err := p.Await(); err == nil {
+			t.Error("error is nil")
+		}
+		if len(out) != 0 {
+			t.Error("value was sent")
+		}
+	})
+}
+
+func TestRedirect(t *testing.T) {
+	t.Run("two redirects", func(t *testing.T) {
+		next := func(s string) *Promise[string] {
+			return NewFn(func() (string, error) {
+				time.Sleep(time.Millisecond)
+				return s + "!", nil
+			})
+		}
+		res, err := Redirect(Redirect(NewResolved("hello world"), next), next).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "hello world!!" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("redirect rejected", func(t *testing.T) {
+		_, err := Redirect(NewResolved("hello world"), func(s string) *Promise[string] {
+			return NewRejected[string](errors.New("hello world"))
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+
+	t.Run("upstream rejected", func(t *testing.T) {
+		_, err := Redirect(NewRejected[string](errors.New("hello world")), func(s string) *Promise[string] {
+			t.Error("function was called")
+			return NewResolved(s)
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+}
+
+func TestThenDefaults(t *testing.T) {
+	defaults := []string{"default"}
+
+	t.Run("success", func(t *testing.T) {
+		res, err := ThenDefaults(NewResolved("hello world"), defaults, func(s string) ([]string, error) {
+			return []string{s}, nil
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if len(res) != 1 || res[0] != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		res, err := ThenDefaults(NewResolved("hello world"), defaults, func(s string) ([]string, error) {
+			return nil, errors.New("hello world")
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if len(res) != 1 || res[0] != "default" {
+			t.Error("defaults were not used")
+		}
+	})
+
+	t.Run("upstream rejected", func(t *testing.T) {
+		res, err := ThenDefaults(NewRejected[string](errors.New("hello world")), defaults, func(s string) ([]string, error) {
+			t.Error("function was called")
+			return nil, nil
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+		if res != nil {
+			t.Error("defaults were used")
+		}
+	})
+}
+
+func TestThenTranslate(t *testing.T) {
+	errMap := func(err error) error {
+		return fmt.Errorf("api: %w", err)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		res, err := ThenTranslate(NewResolved("hello world"), func(s string) (int, error) {
+			return len(s), nil
+		}, errMap).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 11 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := ThenTranslate(NewResolved("hello world"), func(s string) (int, error) {
+			return 0, errors.New("hello world")
+		}, errMap).Await()
+		if err == nil || err.Error() != "api: hello world" {
+			t.Error("error was not mapped")
+		}
+	})
+
+	t.Run("upstream rejected", func(t *testing.T) {
+		_, err := ThenTranslate(NewRejected[string](errors.New("hello world")), func(s string) (int, error) {
+			t.Error("function was called")
+			return 0, nil
+		}, errMap).Await()
+		if err == nil || err.Error() != "api: hello world" {
+			t.Error("error was not mapped")
+		}
+	})
+}
+
+func TestLimitSize(t *testing.T) {
+	sizeof := func(s string) int { return len(s) }
+
+	t.Run("under limit", func(t *testing.T) {
+		res, err := LimitSize(NewResolved("hello world"), 11, sizeof).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("over limit", func(t *testing.T) {
+		_, err := LimitSize(NewResolved("hello world"), 10, sizeof).Await()
+		if !errors.Is(err, ErrTooLarge) {
+			t.Fatal("error is not ErrTooLarge")
+		}
+		if err.Error() != "result is too large: 11 bytes is over the limit of 10 bytes" {
+			t.Error("error message is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := LimitSize(NewRejected[string](errors.New("hello world")), 10, sizeof).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
+
+func TestTee(t *testing.T) {
+	t.Run("resolved", func(t *testing.T) {
+		var seen PromiseResolution[string]
+		res, err := Tee(NewResolved("hello world"), func(r PromiseResolution[string]) {
+			seen = r
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+		if seen.Result != "hello world" || seen.Error != nil {
+			t.Error("sink saw the wrong resolution")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		var seen PromiseResolution[string]
+		e := errors.New("hello world")
+		_, err := Tee(NewRejected[string](e), func(r PromiseResolution[string]) {
+			seen = r
+		}).Await()
+		if err != e {
+			t.Error("error was not passed through")
+		}
+		if seen.Error != e {
+			t.Error("sink saw the wrong resolution")
+		}
+	})
+}
+
+func TestCoerce(t *testing.T) {
+	toInt := func(s string) (int, error) {
+		return strconv.Atoi(s)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		res, err := Coerce(NewResolved("123"), toInt).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 123 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := Coerce(NewResolved("abc"), toInt).Await()
+		if !errors.Is(err, ErrValidation) {
+			t.Fatal("error is not ErrValidation")
+		}
+		if !errors.Is(err, strconv.ErrSyntax) {
+			t.Error("error does not unwrap to the coercion error")
+		}
+		if !strings.HasPrefix(err.Error(), "validation failed: ") {
+			t.Error("error message is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		e := errors.New("hello world")
+		_, err := Coerce(NewRejected[string](e), toInt).Await()
+		if err != e {
+			t.Error("error was not passed through")
+		}
+	})
+}
+
+func TestThenWarn(t *testing.T) {
+	p := ThenWarn(NewResolved("hello world"), func(s string, warn func(error)) (int, error) {
+		warn(errors.New("first"))
+		warn(errors.New("second"))
+		return len(s), nil
+	})
+	p = Then(p, func(i int) (int, error) { return i * 2, nil })
+	_, _ = p.Await()
+	res := p.Resolve()
+	if res.Error != nil {
+		t.Fatal("error is not nil")
+	}
+	if res.Result != 22 {
+		t.Error("result is wrong")
+	}
+	if len(res.Warnings) != 2 || res.Warnings[0].Error() != "first" || res.Warnings[1].Error() != "second" {
+		t.Error("warnings are wrong:", res.Warnings)
+	}
+}
+
+func TestExplode(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		promises, err := Explode(NewResolved([]string{"a", "bb", "ccc"})).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if len(promises) != 3 {
+			t.Fatal("wrong number of promises")
+		}
+		for i, p := range promises {
+			res, err := Then(p, func(s string) (int, error) { return len(s), nil }).Await()
+			if err != nil {
+				t.Fatal("error is not nil")
+			}
+			if res != i+1 {
+				t.Error("result is wrong")
+			}
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := Explode(NewRejected[[]string](errors.New("hello world"))).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
+
+func TestThenCompensate(t *testing.T) {
+	t.Run("undo", func(t *testing.T) {
+		var undone []string
+		p, compensate := ThenCompensate(NewResolved("order-1"), func(id string) (string, error) {
+			return "reservation-" + id, nil
+		}, func(reservation string) error {
+			undone = append(undone, reservation)
+			return errors.New("hello world")
+		})
+		if res, err := p.Await(); err != nil || res != "reservation-order-1" {
+			t.Fatal("result is wrong")
+		}
+		for i := 0; i < 2; i++ {
+			if err := compensate(); err == nil || err.Error() != "hello world" {
+				t.Error("undo error was not returned")
+			}
+		}
+		if len(undone) != 1 || undone[0] != "reservation-order-1" {
+			t.Error("undo was not called once with the result")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, compensate := ThenCompensate(NewRejected[string](errors.New("hello world")), func(id string) (string, error) {
+			t.Error("handler was called")
+			return id, nil
+		}, func(string) error {
+			t.Error("undo was called")
+			return nil
+		})
+		if err := compensate(); err != nil {
+			t.Error("error is not nil")
+		}
+	})
+}
+
+func TestThenWithResource(t *testing.T) {
+	var released int32
+	acquire := func() (string, func(), error) {
+		return "conn", func() { atomic.AddInt32(&released, 1) }, nil
+	}
+
+	t.Run("success", func(t *testing.T) {
+		atomic.StoreInt32(&released, 0)
+		res, err := ThenWithResource(NewResolved("hello"), acquire, func(s string, conn string) (string, error) {
+			return s + " " + conn, nil
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "hello conn" {
+			t.Error("result is wrong")
+		}
+		if atomic.LoadInt32(&released) != 1 {
+			t.Error("resource was not released")
+		}
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		atomic.StoreInt32(&released, 0)
+		_, err := ThenWithResource(NewResolved("hello"), acquire, func(string, string) (string, error) {
+			return "", errors.New("hello world")
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+		if atomic.LoadInt32(&released) != 1 {
+			t.Error("resource was not released")
+		}
+	})
+
+	t.Run("handler panic", func(t *testing.T) {
+		atomic.StoreInt32(&released, 0)
+		_, err := ThenWithResource(NewResolved("hello"), acquire, func(s string, _ string) (string, error) {
+			panic(s)
+		}).Await()
+		var panicErr *PanicError
+		if !errors.As(err, &panicErr) {
+			t.Error("error is not a panic error")
+		}
+		if atomic.LoadInt32(&released) != 1 {
+			t.Error("resource was not released")
+		}
+	})
+
+	t.Run("acquire error", func(t *testing.T) {
+		_, err := ThenWithResource(NewResolved("hello"), func() (string, func(), error) {
+			return "", nil, errors.New("pool exhausted")
+		}, func(string, string) (string, error) {
+			t.Error("handler was called")
+			return "", nil
+		}).Await()
+		if err == nil || err.Error() != "pool exhausted" {
+			t.Error("error is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := ThenWithResource(NewRejected[string](errors.New("hello world")), func() (string, func(), error) {
+			t.Error("acquire was called")
+			return "", nil, nil
+		}, func(string, string) (string, error) {
+			return "", nil
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
+
+func TestThenAccumulate(t *testing.T) {
+	var errs ErrorAccumulator
+	if errs.Err() != nil {
+		t.Error("error is not nil")
+	}
+	errs.Add(nil)
+
+	// Run a pipeline with two failing stages.
+	p := ThenAccumulate(&errs, NewResolved(1), func(i int) (int, error) {
+		return 0, errors.New("first")
+	})
+	p = ThenAccumulate(&errs, p, func(i int) (int, error) {
+		return i + 1, nil
+	})
+	p = ThenAccumulate(&errs, p, func(i int) (int, error) {
+		return 0, errors.New("second")
+	})
+	res, err := p.Await()
+	if err != nil {
+		t.Fatal("error is not nil")
+	}
+	if res != 0 {
+		t.Error("result is not the zero value")
+	}
+
+	// Check the errors.
+	all := errs.Errors()
+	if len(all) != 2 || all[0].Error() != "first" || all[1].Error() != "second" {
+		t.Error("errors are wrong:", all)
+	}
+	var aggErr *AggregateError
+	if !errors.As(errs.Err(), &aggErr) || aggErr.Error() != "first; second" {
+		t.Error("aggregate error is wrong")
+	}
+
+	// Errors from the promise are passed through.
+	_, err = ThenAccumulate(&errs, NewRejected[int](errors.New("hello world")), func(i int) (int, error) {
+		return i, nil
+	}).Await()
+	if err == nil || err.Error() != "hello world" {
+		t.Error("error was not passed through")
+	}
+	if len(errs.Errors()) != 2 {
+		t.Error("error from the promise was added")
+	}
+}
+
+func TestBranch(t *testing.T) {
+	even := func(i int) bool { return i%2 == 0 }
+	half := func(i int) (int, error) { return i / 2, nil }
+	triple := func(i int) (int, error) { return i*3 + 1, nil }
+
+	t.Run("true", func(t *testing.T) {
+		res, err := Branch(NewResolved(4), even, half, triple).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 2 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("false", func(t *testing.T) {
+		res, err := Branch(NewResolved(3), even, half, triple).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 10 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		called := func(int) (int, error) {
+			t.Error("handler was called")
+			return 0, nil
+		}
+		_, err := Branch(NewRejected[int](errors.New("hello world")), even, called, called).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
+
+func TestSwitch(t *testing.T) {
+	cases := map[string]func() (int, error){
+		"start": func() (int, error) { return 1, nil },
+		"stop":  func() (int, error) { return 2, nil },
+	}
+	def := func(s string) (int, error) {
+		return 0, fmt.Errorf("unknown state %q", s)
+	}
+
+	t.Run("match", func(t *testing.T) {
+		res, err := Switch(NewResolved("stop"), cases, def).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 2 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		_, err := Switch(NewResolved("pause"), cases, def).Await()
+		if err == nil || err.Error() != `unknown state "pause"` {
+			t.Error("default was not called")
+		}
+	})
+
+	t.Run("no default", func(t *testing.T) {
+		_, err := Switch(NewResolved("pause"), cases, nil).Await()
+		if err != ErrNilFunc {
+			t.Error("error is not ErrNilFunc")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := Switch(NewRejected[string](errors.New("hello world")), cases, def).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package promise
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Timeout is used to create a promise which rejects with ErrTimeout if the promise is not done within the duration
+// specified. Otherwise, it resolves or rejects the same as the promise. This does not affect the promise itself.
+func Timeout[T any](p *Promise[T], d time.Duration) *Promise[T] {
+	return NewFn(func() (T, error) {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-p.Done():
+			return p.wait()
+		case <-t.C:
+			atomic.AddUint64(&metrics.timedOut, 1)
+			var zero T
+			return zero, ErrTimeout
+		}
+	})
+}
+
+// AllWithItemTimeout behaves the same as All but rejects if any promise is not done within the item timeout.
+// The error will match ErrTimeout (using errors.Is) and contains the index of the promise that timed out.
+func AllWithItemTimeout[T any](itemTimeout time.Duration, promises ...*Promise[T]) ([]T, error) {
+	// Wrap each promise with a timeout.
+	wrapped := make([]*Promise[T], len(promises))
+	for i, p := range promises {
+		index := i
+		wrapped[i] = handle(Timeout(p, itemTimeout), func(res T, err error) (T, error) {
+			if errors.Is(err, ErrTimeout) {
+				err = fmt.Errorf("promise %d: %w", index, err)
+			}
+			return res, err
+		})
+	}
+
+	// Wait for all of them.
+	return All(wrapped...)
+}
+
+// ThenTimeout behaves the same as Then but the new promise rejects with ErrTimeout if the handler does not return
+// within the duration specified. The handler keeps running in its own go-routine, but its result is ignored.
+func ThenTimeout[T any, X any](p *Promise[T], d time.Duration, f func(T) (X, error)) *Promise[X] {
+	return Then(p, func(res T) (X, error) {
+		return Timeout(NewFnWithArg(res, f), d).wait()
+	})
+}
+
+// Throttled is used to create a promise which does not resolve or reject until the window has passed since it was
+// made, even if the promise is done sooner. If the promise takes longer than the window, the new promise is done as
+// soon as it is. This is useful for smoothing out latency, such as showing a loading spinner for a minimum time.
+func Throttled[T any](window time.Duration, p *Promise[T]) *Promise[T] {
+	t := time.NewTimer(window)
+	return NewFn(func() (T, error) {
+		res, err := p.wait()
+		<-t.C
+		return res, err
+	})
+}
+
+// TimeoutFallback behaves the same as Timeout but if the promise is not done within the duration specified, the
+// promise returned by the fallback is used instead. The new promise then resolves or rejects the same as the
+// fallback promise, and the late result of the original promise is ignored. This is useful for hedged reads where a
+// secondary source is only tried when the primary is slow.
+func TimeoutFallback[T any](p *Promise[T], d time.Duration, fallback func() *Promise[T]) *Promise[T] {
+	return NewFn(func() (T, error) {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-p.Done():
+			return p.wait()
+		case <-t.C:
+			atomic.AddUint64(&metrics.timedOut, 1)
+			return fallback().wait()
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package promise
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	t.Run("in time", func(t *testing.T) {
+		res, err := Timeout(NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 2)
+			return "hello world", nil
+		}), time.Second).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("rejected in time", func(t *testing.T) {
+		_, err := Timeout(NewRejected[string](errors.New("hello world")), time.Second).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		p := &Promise[string]{notDone: true}
+		_, err := Timeout(p, time.Millisecond*5).Await()
+		if err != ErrTimeout {
+			t.Error("error is not ErrTimeout")
+		}
+		if p.Resolve() != nil {
+			t.Error("promise was affected")
+		}
+	})
+}
+
+func TestAllWithItemTimeout(t *testing.T) {
+	t.Run("in time", func(t *testing.T) {
+		a, err := AllWithItemTimeout(time.Second, NewResolved("hello"), NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 2)
+			return "world", nil
+		}))
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if len(a) != 2 || a[0] != "hello" || a[1] != "world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := AllWithItemTimeout(time.Second, NewRejected[string](errors.New("hello world")))
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		_, err := AllWithItemTimeout(time.Millisecond*5,
+			NewResolved("hello"),
+			NewFn(func() (string, error) {
+				time.Sleep(time.Millisecond * 50)
+				return "world", nil
+			}),
+		)
+		if !errors.Is(err, ErrTimeout) {
+			t.Fatal("error is not ErrTimeout")
+		}
+		if err.Error() != "promise 1: promise timed out" {
+			t.Error("error does not contain the index")
+		}
+	})
+}
+
+func TestThenTimeout(t *testing.T) {
+	t.Run("in time", func(t *testing.T) {
+		res, err := ThenTimeout(NewResolved("hello world"), time.Second, func(s string) (int, error) {
+			return len(s), nil
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != 11 {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		gate := make(chan struct{})
+		defer close(gate)
+		_, err := ThenTimeout(NewResolved("hello world"), time.Millisecond*10, func(s string) (int, error) {
+			<-gate
+			return len(s), nil
+		}).Await()
+		if err != ErrTimeout {
+			t.Error("error is not ErrTimeout")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := ThenTimeout(NewRejected[string](errors.New("hello world")), time.Second, func(s string) (int, error) {
+			t.Error("handler was called")
+			return 0, nil
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
+
+func TestThrottled(t *testing.T) {
+	t.Run("fast", func(t *testing.T) {
+		start := time.Now()
+		res, err := Throttled(time.Millisecond*20, NewResolved("hello world")).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "hello world" {
+			t.Error("result is wrong")
+		}
+		if time.Since(start) < time.Millisecond*20 {
+			t.Error("promise was not delayed")
+		}
+	})
+
+	t.Run("slow", func(t *testing.T) {
+		start := time.Now()
+		_, err := Throttled(time.Millisecond*5, NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 20)
+			return "", errors.New("hello world")
+		})).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+		if d := time.Since(start); d < time.Millisecond*20 || d > time.Millisecond*200 {
+			t.Error("promise was not done when the promise was")
+		}
+	})
+}
+
+func TestTimeoutFallback(t *testing.T) {
+	t.Run("in time", func(t *testing.T) {
+		res, err := TimeoutFallback(NewResolved("primary"), time.Second, func() *Promise[string] {
+			t.Error("fallback was called")
+			return NewResolved("fallback")
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "primary" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("slow", func(t *testing.T) {
+		slow := NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 50)
+			return "primary", nil
+		})
+		start := time.Now()
+		res, err := TimeoutFallback(slow, time.Millisecond*5, func() *Promise[string] {
+			return NewResolved("fallback")
+		}).Await()
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if res != "fallback" {
+			t.Error("result is wrong")
+		}
+		if time.Since(start) >= time.Millisecond*50 {
+			t.Error("did not wait for the fallback only")
+		}
+	})
+
+	t.Run("fallback rejected", func(t *testing.T) {
+		slow := NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 50)
+			return "primary", nil
+		})
+		_, err := TimeoutFallback(slow, time.Millisecond*5, func() *Promise[string] {
+			return NewRejected[string](errors.New("hello world"))
+		}).Await()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error was not passed through")
+		}
+	})
+}
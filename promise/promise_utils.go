@@ -2,6 +2,8 @@ package promise
 
 import (
 	"errors"
+	"strings"
+	"sync"
 	"sync/atomic"
 
 	"golang.org/x/sync/errgroup"
@@ -21,12 +23,10 @@ func All[T any](promises ...*Promise[T]) ([]T, error) {
 		x := p
 		wg.Go(func() error {
 			errChan := make(chan error)
-			Then(x, func(res T) (struct{}, error) {
-				*ptr = res
-				errChan <- nil
-				return struct{}{}, nil
-			})
-			Catch(x, func(err error) (struct{}, error) {
+			handle(x, func(res T, err error) (struct{}, error) {
+				if err == nil {
+					*ptr = res
+				}
 				errChan <- err
 				return struct{}{}, nil
 			})
@@ -38,8 +38,200 @@ func All[T any](promises ...*Promise[T]) ([]T, error) {
 	return results, wg.Wait()
 }
 
-// NoPromises is used for Race where it is expected that promises will be set.
-var NoPromises = errors.New("no promises specified")
+// AllProgress behaves the same as All but calls onProgress each time a promise resolves or rejects. The calls are
+// made one at a time with how many promises are done and the total. If all promises resolve, every call is made
+// before this returns, so the last call will have done equal to total.
+func AllProgress[T any](onProgress func(done, total int), promises ...*Promise[T]) ([]T, error) {
+	// Defines the progress.
+	var (
+		lock sync.Mutex
+		done int
+	)
+	total := len(promises)
+	wg := sync.WaitGroup{}
+	wg.Add(total)
+	report := func() {
+		lock.Lock()
+		done++
+		onProgress(done, total)
+		lock.Unlock()
+		wg.Done()
+	}
+
+	// Go through each promise and hook handlers to it.
+	for _, p := range promises {
+		handle(p, func(T, error) (struct{}, error) {
+			report()
+			return struct{}{}, nil
+		})
+	}
+
+	// Wait for the promises and then the progress.
+	results, err := All(promises...)
+	if err != nil {
+		return results, err
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// AggregateError is used to hold the errors of a batch of promises. The errors are stored by the index of the promise.
+type AggregateError struct {
+	errs []error
+}
+
+// Error is used to return all of the errors joined together.
+func (e *AggregateError) Error() string {
+	msgs := []string{}
+	for _, err := range e.errs {
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap is used to return all the errors that are not nil.
+func (e *AggregateError) Unwrap() []error {
+	errs := []error{}
+	for _, err := range e.errs {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Is is used to check if any of the errors match the target. This allows errors.Is to be used on Go versions
+// which do not unwrap multiple errors.
+func (e *AggregateError) Is(target error) bool {
+	for _, err := range e.errs {
+		if err != nil && errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As is used to find the first error which matches the target and set the target to it. This allows errors.As
+// to be used on Go versions which do not unwrap multiple errors.
+func (e *AggregateError) As(target interface{}) bool {
+	for _, err := range e.errs {
+		if err != nil && errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors is used to get the errors by the index of the promise. Successful promises will have a nil entry.
+func (e *AggregateError) Errors() []error {
+	return e.errs
+}
+
+// AllErrors behaves like All but waits for every promise to be done instead of returning the first error.
+// If any promise rejects, an *AggregateError containing every error is returned. Rejected promises will have
+// a zero value in the results.
+func AllErrors[T any](promises ...*Promise[T]) ([]T, error) {
+	// Defines the results and errors.
+	results := make([]T, len(promises))
+	errs := make([]error, len(promises))
+	failed := false
+
+	// Wait for each promise in order.
+	next := Iterator(promises...)
+	for i := range promises {
+		results[i], _, errs[i] = next()
+		if errs[i] != nil {
+			failed = true
+		}
+	}
+
+	// Return the aggregate error if anything failed.
+	if failed {
+		return results, &AggregateError{errs: errs}
+	}
+	return results, nil
+}
+
+// DynamicAll is used to wait for a set of promises which is not known up front. Promises can be added from many
+// go-routines until Wait is called. The zero value is ready to use.
+type DynamicAll[T any] struct {
+	// defines the lock for the promises.
+	lock sync.Mutex
+
+	// defines the promises which were added.
+	promises []*Promise[T]
+
+	// defines if Wait was called.
+	waiting bool
+}
+
+// Add is used to add a promise to the set. This will panic if Wait has already been called.
+func (d *DynamicAll[T]) Add(p *Promise[T]) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.waiting {
+		panic("promise: DynamicAll.Add called after Wait")
+	}
+	d.promises = append(d.promises, p)
+}
+
+// Wait is used to wait for all the added promises. The results are in the order the promises were added.
+// If one promise rejects, the error will be returned. No promises can be added once this is called.
+func (d *DynamicAll[T]) Wait() ([]T, error) {
+	d.lock.Lock()
+	d.waiting = true
+	promises := d.promises
+	d.lock.Unlock()
+	return All(promises...)
+}
+
+// Distinct behaves the same as All but removes any duplicate results. The first of each result is kept, so the
+// results stay in the order of the promises. If one promise rejects, the error will be returned.
+func Distinct[T comparable](promises ...*Promise[T]) ([]T, error) {
+	// Wait for all the promises.
+	results, err := All(promises...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove the duplicates.
+	seen := make(map[T]struct{}, len(results))
+	distinct := make([]T, 0, len(results))
+	for _, v := range results {
+		if _, ok := seen[v]; !ok {
+			seen[v] = struct{}{}
+			distinct = append(distinct, v)
+		}
+	}
+	return distinct, nil
+}
+
+// GroupBy is used to wait for all the promises and group the results by the key function. The results in each group
+// are in the order the promises resolved. If one promise rejects, the first error will immediately be returned.
+func GroupBy[T any, K comparable](key func(T) K, promises ...*Promise[T]) (map[K][]T, error) {
+	// Send each resolution down the channel when it is done. This is buffered so nothing is left blocking.
+	ch := make(chan PromiseResolution[T], len(promises))
+	for _, p := range promises {
+		handle(p, func(res T, err error) (struct{}, error) {
+			ch <- PromiseResolution[T]{Result: res, Error: err}
+			return struct{}{}, nil
+		})
+	}
+
+	// Group the results in the order they come in.
+	groups := map[K][]T{}
+	for range promises {
+		r := <-ch
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		k := key(r.Result)
+		groups[k] = append(groups[k], r.Result)
+	}
+	return groups, nil
+}
 
 // Race returns the result of the first promise to resolve.
 func Race[T any](promises ...*Promise[T]) (T, error) {
@@ -54,18 +246,11 @@ func Race[T any](promises ...*Promise[T]) (T, error) {
 	errorCh := make(chan error)
 	var res T
 	for _, p := range promises {
-		Then(p, func(innerRes T) (struct{}, error) {
+		handle(p, func(innerRes T, innerErr error) (struct{}, error) {
 			if atomic.SwapUintptr(&done, 1) == 1 {
 				return struct{}{}, nil
 			}
 			res = innerRes
-			errorCh <- nil
-			return struct{}{}, nil
-		})
-		Catch(p, func(innerErr error) (struct{}, error) {
-			if atomic.SwapUintptr(&done, 1) == 1 {
-				return struct{}{}, nil
-			}
 			errorCh <- innerErr
 			return struct{}{}, nil
 		})
@@ -95,13 +280,8 @@ func Iterator[T any](promises ...*Promise[T]) func() (val T, end bool, err error
 
 		// Go the hook path.
 		waitCh := make(chan struct{})
-		Then(p, func(res T) (struct{}, error) {
-			val = res
-			waitCh <- struct{}{}
-			return struct{}{}, nil
-		})
-		Catch(p, func(innerErr error) (struct{}, error) {
-			err = innerErr
+		handle(p, func(res T, innerErr error) (struct{}, error) {
+			val, err = res, innerErr
 			waitCh <- struct{}{}
 			return struct{}{}, nil
 		})
@@ -109,3 +289,165 @@ func Iterator[T any](promises ...*Promise[T]) func() (val T, end bool, err error
 		return
 	}
 }
+
+// Paginate is used to create a function to iterate over the items of a paginated source. Each page is fetched
+// with a promise when the items before it have been used, and the first fetch is given a blank cursor. Iteration
+// ends when a page returns a blank next cursor and its items have been used, or after an error is returned.
+// Note the next function is not thread safe!
+func Paginate[T any](fetch func(cursor string) (items []T, nextCursor string, err error)) func() (val T, end bool, err error) {
+	type page struct {
+		items []T
+		next  string
+	}
+	var (
+		items    []T
+		index    int
+		cursor   string
+		finished bool
+	)
+	return func() (val T, end bool, err error) {
+		for index == len(items) {
+			if finished {
+				// We have exhausted all pages.
+				end = true
+				return
+			}
+
+			// Fetch the next page.
+			c := cursor
+			res, err := NewFn(func() (page, error) {
+				items, next, err := fetch(c)
+				return page{items: items, next: next}, err
+			}).wait()
+			if err != nil {
+				finished = true
+				return val, false, err
+			}
+			items, index, cursor = res.items, 0, res.next
+			finished = cursor == ""
+		}
+
+		// Return the next item.
+		val = items[index]
+		index++
+		return
+	}
+}
+
+// OrderTracker is used to find the order that promises resolved or rejected in. The returned promise resolves
+// with the indexes of the promises in the order they were done once they are all done. This is mainly useful
+// for testing concurrency.
+func OrderTracker[T any](promises ...*Promise[T]) *Promise[[]int] {
+	// Defines the order and the lock for it.
+	order := make([]int, 0, len(promises))
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	wg.Add(len(promises))
+
+	// Go through each promise and hook handlers to it.
+	for i, p := range promises {
+		index := i
+		record := func() {
+			lock.Lock()
+			order = append(order, index)
+			lock.Unlock()
+			wg.Done()
+		}
+		handle(p, func(T, error) (struct{}, error) {
+			record()
+			return struct{}{}, nil
+		})
+	}
+
+	// Return a promise that resolves when everything is done.
+	return NewFn(func() ([]int, error) {
+		wg.Wait()
+		return order, nil
+	})
+}
+
+// LastN is used to wait for all promises and return the last n results in the order the promises resolved.
+// Rejected promises are skipped. If every promise rejects, an *AggregateError is returned.
+func LastN[T any](n int, promises ...*Promise[T]) ([]T, error) {
+	// Wait for all the promises and get the order they were done in.
+	order, _ := OrderTracker(promises...).wait()
+
+	// Get the results in the order.
+	results := []T{}
+	errs := make([]error, len(promises))
+	for _, i := range order {
+		res, _ := promises[i].Snapshot()
+		if res.Error != nil {
+			errs[i] = res.Error
+			continue
+		}
+		results = append(results, res.Result)
+	}
+	if len(results) == 0 && len(promises) != 0 {
+		return nil, &AggregateError{errs: errs}
+	}
+
+	// Return the last n results.
+	if n < 0 {
+		n = 0
+	}
+	if len(results) > n {
+		results = results[len(results)-n:]
+	}
+	return results, nil
+}
+
+// MapSliceIndexed is used to create a promise for each item in the slice. The function is called with the index
+// and the item, and the promises are returned in the same order as the items.
+func MapSliceIndexed[T any, X any](items []T, f func(int, T) (X, error)) []*Promise[X] {
+	promises := make([]*Promise[X], len(items))
+	for i, item := range items {
+		index := i
+		v := item
+		promises[i] = NewFn(func() (X, error) { return f(index, v) })
+	}
+	return promises
+}
+
+// Cur is a cursor over promises which is made with Cursor. This works in a similar way to sql.Rows.
+// Note the cursor is not thread safe!
+type Cur[T any] struct {
+	next  func() (T, bool, error)
+	value T
+	err   error
+}
+
+// Cursor is used to create a cursor to iterate over promises. This is built on top of Iterator.
+func Cursor[T any](promises ...*Promise[T]) *Cur[T] {
+	return &Cur[T]{next: Iterator(promises...)}
+}
+
+// Next is used to wait for the next promise. This returns false when there are no more promises or when a
+// promise rejects. Err should be checked afterwards to find out which it was.
+func (c *Cur[T]) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	val, end, err := c.next()
+	if end {
+		return false
+	}
+	if err != nil {
+		var zero T
+		c.value = zero
+		c.err = err
+		return false
+	}
+	c.value = val
+	return true
+}
+
+// Value is used to get the result of the current promise.
+func (c *Cur[T]) Value() T {
+	return c.value
+}
+
+// Err is used to get the error which stopped the cursor. This is nil if the cursor got to the end.
+func (c *Cur[T]) Err() error {
+	return c.err
+}
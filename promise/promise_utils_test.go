@@ -2,6 +2,8 @@ package promise
 
 import (
 	"errors"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 )
@@ -40,6 +42,293 @@ func TestAll(t *testing.T) {
 	})
 }
 
+func TestAllProgress(t *testing.T) {
+	t.Run("resolved", func(t *testing.T) {
+		calls := [][2]int{}
+		promises := []*Promise[int]{NewResolved(0)}
+		for i := 1; i < 5; i++ {
+			x := i
+			promises = append(promises, NewFn(func() (int, error) {
+				time.Sleep(time.Millisecond * time.Duration(x))
+				return x, nil
+			}))
+		}
+		a, err := AllProgress(func(done, total int) {
+			calls = append(calls, [2]int{done, total})
+		}, promises...)
+		if err != nil {
+			t.Fatal("error isn't nil")
+		}
+		for i, v := range a {
+			if v != i {
+				t.Error("value is wrong")
+			}
+		}
+		if len(calls) != 5 {
+			t.Fatal("progress call count is wrong")
+		}
+		for i, c := range calls {
+			if c[0] != i+1 || c[1] != 5 {
+				t.Error("progress is wrong")
+			}
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := AllProgress(func(done, total int) {}, NewRejected[int](errors.New("hello world")))
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+}
+
+func TestAllErrors(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		a, err := AllErrors[string]()
+		if err != nil {
+			t.Error("error isn't nil")
+		}
+		if len(a) != 0 {
+			t.Error("length is wrong")
+		}
+	})
+
+	t.Run("resolved", func(t *testing.T) {
+		a, err := AllErrors(NewResolved("hello"), NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 2)
+			return "world", nil
+		}))
+		if err != nil {
+			t.Fatal("error isn't nil")
+		}
+		if a[0] != "hello" || a[1] != "world" {
+			t.Error("value is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		errA := errors.New("hello")
+		errB := errors.New("world")
+		a, err := AllErrors(
+			NewRejected[string](errA),
+			NewResolved("hello world"),
+			NewFn(func() (string, error) {
+				time.Sleep(time.Millisecond * 2)
+				return "", errB
+			}),
+		)
+		if a[1] != "hello world" {
+			t.Error("value is wrong")
+		}
+		var aggr *AggregateError
+		if !errors.As(err, &aggr) {
+			t.Fatal("error is not an aggregate error")
+		}
+		errs := aggr.Errors()
+		if len(errs) != 3 || errs[0] != errA || errs[1] != nil || errs[2] != errB {
+			t.Error("errors are wrong")
+		}
+		if len(aggr.Unwrap()) != 2 {
+			t.Error("unwrapped errors are wrong")
+		}
+		if !errors.Is(err, errA) || !errors.Is(err, errB) {
+			t.Error("errors are not matched")
+		}
+		if !aggr.Is(errA) || !aggr.Is(errB) || aggr.Is(errors.New("hello")) {
+			t.Error("errors are not matched without unwrapping")
+		}
+		var custom customWrapError
+		if aggr.As(&custom) {
+			t.Error("error matched the wrong type")
+		}
+		aggr = &AggregateError{errs: []error{nil, customWrapError{err: errA}}}
+		if !aggr.As(&custom) || custom.err != errA {
+			t.Error("error was not matched without unwrapping")
+		}
+		if err.Error() != "hello; world" {
+			t.Error("message is wrong")
+		}
+	})
+}
+
+func TestDynamicAll(t *testing.T) {
+	t.Run("resolved", func(t *testing.T) {
+		d := &DynamicAll[int]{}
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.Add(NewFn(func() (int, error) {
+					time.Sleep(time.Millisecond)
+					return 1, nil
+				}))
+			}()
+		}
+		wg.Wait()
+		d.Add(NewResolved(2))
+		a, err := d.Wait()
+		if err != nil {
+			t.Fatal("error isn't nil")
+		}
+		if len(a) != 11 {
+			t.Fatal("length is wrong")
+		}
+		for _, v := range a[:10] {
+			if v != 1 {
+				t.Error("value is wrong")
+			}
+		}
+		if a[10] != 2 {
+			t.Error("value is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		d := &DynamicAll[int]{}
+		d.Add(NewResolved(1))
+		d.Add(NewRejected[int](errors.New("hello world")))
+		_, err := d.Wait()
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+
+	t.Run("add after wait", func(t *testing.T) {
+		d := &DynamicAll[int]{}
+		if _, err := d.Wait(); err != nil {
+			t.Error("error isn't nil")
+		}
+		defer func() {
+			if recover() == nil {
+				t.Error("add did not panic")
+			}
+		}()
+		d.Add(NewResolved(1))
+	})
+}
+
+func TestDistinct(t *testing.T) {
+	t.Run("duplicates", func(t *testing.T) {
+		a, err := Distinct(
+			NewResolved("b"),
+			NewFn(func() (string, error) {
+				time.Sleep(time.Millisecond * 2)
+				return "a", nil
+			}),
+			NewResolved("b"),
+			NewResolved("c"),
+			NewResolved("a"),
+		)
+		if err != nil {
+			t.Fatal("error isn't nil")
+		}
+		if len(a) != 3 || a[0] != "b" || a[1] != "a" || a[2] != "c" {
+			t.Error("value is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		_, err := Distinct(NewResolved("a"), NewRejected[string](errors.New("hello world")))
+		if err == nil {
+			t.Fatal("error is nil")
+		}
+		if err.Error() != "hello world" {
+			t.Error("value is wrong")
+		}
+	})
+}
+
+func TestGroupBy(t *testing.T) {
+	parity := func(i int) string {
+		if i%2 == 0 {
+			return "even"
+		}
+		return "odd"
+	}
+
+	t.Run("grouped", func(t *testing.T) {
+		delayed := func(i int, d time.Duration) *Promise[int] {
+			return NewFn(func() (int, error) {
+				time.Sleep(d)
+				return i, nil
+			})
+		}
+		groups, err := GroupBy(parity,
+			delayed(1, time.Millisecond*30),
+			delayed(2, time.Millisecond*10),
+			delayed(3, time.Millisecond*10),
+			delayed(4, time.Millisecond*30),
+		)
+		if err != nil {
+			t.Fatal("error is not nil")
+		}
+		if len(groups) != 2 {
+			t.Fatal("wrong number of groups")
+		}
+		if fmt.Sprint(groups["odd"]) != "[3 1]" {
+			t.Error("odd group is wrong:", groups["odd"])
+		}
+		if fmt.Sprint(groups["even"]) != "[2 4]" {
+			t.Error("even group is wrong:", groups["even"])
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := GroupBy(parity, NewResolved(1), NewRejected[int](errors.New("hello world")))
+		if err == nil || err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+}
+
+func TestPaginate(t *testing.T) {
+	t.Run("pages", func(t *testing.T) {
+		pages := map[string]struct {
+			items []string
+			next  string
+		}{
+			"":  {items: []string{"a", "b"}, next: "2"},
+			"2": {items: []string{}, next: "3"},
+			"3": {items: []string{"c"}},
+		}
+		var fetched []string
+		next := Paginate(func(cursor string) ([]string, string, error) {
+			fetched = append(fetched, cursor)
+			p := pages[cursor]
+			return p.items, p.next, nil
+		})
+		var items []string
+		for s, end, err := next(); !end; s, end, err = next() {
+			if err != nil {
+				t.Fatal("error is not nil")
+			}
+			items = append(items, s)
+		}
+		if fmt.Sprint(items) != "[a b c]" {
+			t.Error("items are wrong:", items)
+		}
+		if fmt.Sprint(fetched) != "[ 2 3]" {
+			t.Error("pages fetched are wrong:", fetched)
+		}
+		if _, end, _ := next(); !end {
+			t.Error("iterator did not stay ended")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		next := Paginate(func(cursor string) ([]string, string, error) {
+			return nil, "", errors.New("hello world")
+		})
+		if _, end, err := next(); end || err == nil || err.Error() != "hello world" {
+			t.Error("error was not returned")
+		}
+		if _, end, _ := next(); !end {
+			t.Error("iterator did not end after the error")
+		}
+	})
+}
+
 func TestRace(t *testing.T) {
 	t.Run("empty", func(t *testing.T) {
 		_, err := Race[string]()
@@ -189,3 +478,148 @@ func TestIterator(t *testing.T) {
 		t.Error("end is in wrong place")
 	}
 }
+
+func TestOrderTracker(t *testing.T) {
+	delayed := func(d int, err error) *Promise[string] {
+		return NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * time.Duration(d))
+			return "hello world", err
+		})
+	}
+	p := OrderTracker(
+		delayed(30, nil),
+		delayed(10, errors.New("hello world")),
+		delayed(40, nil),
+		delayed(20, nil),
+	)
+	<-p.Done()
+	res := p.Resolve()
+	if res.Error != nil {
+		t.Fatal("error isn't nil")
+	}
+	want := []int{1, 3, 0, 2}
+	if len(res.Result) != len(want) {
+		t.Fatal("length is wrong")
+	}
+	for i, v := range want {
+		if res.Result[i] != v {
+			t.Error("order is wrong")
+		}
+	}
+}
+
+func TestLastN(t *testing.T) {
+	delayed := func(d int, s string, err error) *Promise[string] {
+		return NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * time.Duration(d))
+			return s, err
+		})
+	}
+
+	t.Run("more than n", func(t *testing.T) {
+		a, err := LastN(2,
+			delayed(40, "a", nil),
+			delayed(10, "b", nil),
+			delayed(30, "c", errors.New("hello world")),
+			delayed(20, "d", nil),
+		)
+		if err != nil {
+			t.Fatal("error isn't nil")
+		}
+		if len(a) != 2 || a[0] != "d" || a[1] != "a" {
+			t.Error("value is wrong")
+		}
+	})
+
+	t.Run("less than n", func(t *testing.T) {
+		a, err := LastN(5, NewResolved("a"))
+		if err != nil {
+			t.Fatal("error isn't nil")
+		}
+		if len(a) != 1 || a[0] != "a" {
+			t.Error("value is wrong")
+		}
+	})
+
+	t.Run("negative n", func(t *testing.T) {
+		a, err := LastN(-1, NewResolved("a"))
+		if err != nil {
+			t.Fatal("error isn't nil")
+		}
+		if len(a) != 0 {
+			t.Error("length is wrong")
+		}
+	})
+
+	t.Run("all rejected", func(t *testing.T) {
+		_, err := LastN(2, NewRejected[string](errors.New("hello world")))
+		var aggr *AggregateError
+		if !errors.As(err, &aggr) {
+			t.Fatal("error is not an aggregate error")
+		}
+		if err.Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+	})
+}
+
+func TestMapSliceIndexed(t *testing.T) {
+	items := []string{"a", "b", "c"}
+	promises := MapSliceIndexed(items, func(i int, s string) (string, error) {
+		time.Sleep(time.Millisecond * time.Duration(3-i))
+		return fmt.Sprint(i, s), nil
+	})
+	if len(promises) != 3 {
+		t.Fatal("length is wrong")
+	}
+	res, err := All(promises...)
+	if err != nil {
+		t.Fatal("error isn't nil")
+	}
+	if res[0] != "0a" || res[1] != "1b" || res[2] != "2c" {
+		t.Error("value is wrong")
+	}
+}
+
+func TestCursor(t *testing.T) {
+	t.Run("resolved", func(t *testing.T) {
+		c := Cursor(NewResolved("hello"), NewFn(func() (string, error) {
+			time.Sleep(time.Millisecond * 2)
+			return "world", nil
+		}))
+		a := []string{}
+		for c.Next() {
+			a = append(a, c.Value())
+		}
+		if c.Err() != nil {
+			t.Error("error isn't nil")
+		}
+		if len(a) != 2 || a[0] != "hello" || a[1] != "world" {
+			t.Error("value is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		c := Cursor(
+			NewResolved("hello"),
+			NewRejected[string](errors.New("hello world")),
+			NewResolved("world"),
+		)
+		a := []string{}
+		for c.Next() {
+			a = append(a, c.Value())
+		}
+		if c.Err() == nil || c.Err().Error() != "hello world" {
+			t.Error("error is wrong")
+		}
+		if len(a) != 1 || a[0] != "hello" {
+			t.Error("value is wrong")
+		}
+		if c.Value() != "" {
+			t.Error("value is not blank")
+		}
+		if c.Next() {
+			t.Error("cursor continued after error")
+		}
+	})
+}
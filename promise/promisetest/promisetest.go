@@ -0,0 +1,88 @@
+// Package promisetest provides helpers for testing code which uses promises.
+package promisetest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jakemakesstuff/pinkypromise/promise"
+)
+
+// DefaultTimeout is how long MustResolve waits for a promise before failing the test.
+var DefaultTimeout = 5 * time.Second
+
+// Defines the promises which are tracked for a test.
+type tracker struct {
+	lock     sync.Mutex
+	promises []interface{}
+	awaited  map[interface{}]bool
+}
+
+// Defines the trackers for each test.
+var (
+	trackersLock sync.Mutex
+	trackers     = map[testing.TB]*tracker{}
+)
+
+// Gets the tracker for the test. If create is true and there is no tracker, one is made.
+func getTracker(t testing.TB, create bool) *tracker {
+	trackersLock.Lock()
+	defer trackersLock.Unlock()
+	tr := trackers[t]
+	if tr == nil && create {
+		tr = &tracker{awaited: map[interface{}]bool{}}
+		trackers[t] = tr
+		t.Cleanup(func() {
+			// Remove the tracker.
+			trackersLock.Lock()
+			delete(trackers, t)
+			trackersLock.Unlock()
+
+			// Warn about any promises which were never awaited.
+			tr.lock.Lock()
+			defer tr.lock.Unlock()
+			for i, p := range tr.promises {
+				if !tr.awaited[p] {
+					t.Logf("warning: tracked promise %d was never awaited", i)
+				}
+			}
+		})
+	}
+	return tr
+}
+
+// Track is used to track the promise for the test. When the test finishes, a warning is logged for every tracked
+// promise which was never passed to MustResolve. This helps to find promises which leaked. The promise is returned.
+func Track[T any](t testing.TB, p *promise.Promise[T]) *promise.Promise[T] {
+	t.Helper()
+	tr := getTracker(t, true)
+	tr.lock.Lock()
+	tr.promises = append(tr.promises, p)
+	tr.lock.Unlock()
+	return p
+}
+
+// MustResolve is used to wait for the promise and return the result. If the promise rejects, or does not resolve
+// within DefaultTimeout, the test is failed with t.Fatalf.
+func MustResolve[T any](t testing.TB, p *promise.Promise[T]) T {
+	t.Helper()
+
+	// Mark the promise as awaited if it is tracked.
+	if tr := getTracker(t, false); tr != nil {
+		tr.lock.Lock()
+		tr.awaited[p] = true
+		tr.lock.Unlock()
+	}
+
+	// Wait for the promise.
+	timeout := DefaultTimeout
+	res, err := p.AwaitTimeout(timeout)
+	if err == promise.ErrTimeout && p.Resolve() == nil {
+		t.Fatalf("promise did not resolve within %s", timeout)
+	}
+	if err != nil {
+		t.Fatalf("promise rejected: %v", err)
+	}
+	return res
+}
@@ -0,0 +1,122 @@
+package promisetest
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jakemakesstuff/pinkypromise/promise"
+)
+
+type fakeTB struct {
+	testing.TB
+
+	fatal    string
+	logs     []string
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.fatal = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+func (f *fakeTB) Logf(format string, args ...interface{}) {
+	f.logs = append(f.logs, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+func (f *fakeTB) cleanup() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+// Runs the function in a new go-routine so Fatalf can exit it.
+func run(f func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	<-done
+}
+
+func TestMustResolve(t *testing.T) {
+	t.Run("resolved", func(t *testing.T) {
+		if MustResolve(t, promise.NewResolved("hello world")) != "hello world" {
+			t.Error("result is wrong")
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		tb := &fakeTB{}
+		run(func() {
+			MustResolve(tb, promise.NewRejected[string](errors.New("hello world")))
+			t.Error("test was not failed")
+		})
+		if tb.fatal != "promise rejected: hello world" {
+			t.Error("failure is wrong")
+		}
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		old := DefaultTimeout
+		DefaultTimeout = time.Millisecond * 5
+		defer func() { DefaultTimeout = old }()
+		tb := &fakeTB{}
+		run(func() {
+			MustResolve(tb, promise.NewFn(func() (string, error) {
+				time.Sleep(time.Millisecond * 50)
+				return "hello world", nil
+			}))
+		})
+		if tb.fatal != "promise did not resolve within 5ms" {
+			t.Error("failure is wrong")
+		}
+	})
+
+	t.Run("rejected with timeout error", func(t *testing.T) {
+		tb := &fakeTB{}
+		run(func() {
+			MustResolve(tb, promise.NewRejected[string](promise.ErrTimeout))
+		})
+		if tb.fatal != "promise rejected: promise timed out" {
+			t.Error("failure is wrong")
+		}
+	})
+}
+
+func TestTrack(t *testing.T) {
+	t.Run("awaited", func(t *testing.T) {
+		tb := &fakeTB{}
+		p := Track(tb, promise.NewResolved("hello world"))
+		MustResolve(tb, p)
+		tb.cleanup()
+		if len(tb.logs) != 0 {
+			t.Error("warning was logged")
+		}
+	})
+
+	t.Run("not awaited", func(t *testing.T) {
+		tb := &fakeTB{}
+		Track(tb, promise.NewResolved("hello world"))
+		p := Track(tb, promise.NewResolved("hello world"))
+		MustResolve(tb, p)
+		tb.cleanup()
+		if len(tb.logs) != 1 || !strings.Contains(tb.logs[0], "tracked promise 0 was never awaited") {
+			t.Error("warning was not logged")
+		}
+		if getTracker(tb, false) != nil {
+			t.Error("tracker was not removed")
+		}
+	})
+}